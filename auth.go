@@ -0,0 +1,284 @@
+package instanceid
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authorizer decides whether an iid-request is answered, and how much of the
+// call graph may be disclosed to it
+type Authorizer interface {
+	// Authorize returns the Grant of the key of the iid-request r and true,
+	// or false if r must not be answered
+	Authorize(r IidRequest) (grant Grant, ok bool)
+}
+
+// Grant describes what a key is authorised for
+type Grant struct {
+	// Scope caps the disclosure, Shallow keys never get the call graph
+	Scope Disclosure
+
+	// Expires is the time the key expires. Zero never expires.
+	Expires time.Time
+
+	// SealKey is the secret shared with the holder of the key, keying the
+	// Ciids sealed for it, see Seal. Nil if the key holder cannot open
+	// sealed Ciids.
+	SealKey []byte
+}
+
+func (g Grant) expired(now time.Time) bool {
+	return !g.Expires.IsZero() && !now.Before(g.Expires)
+}
+
+// StaticKeys is an Authorizer granting the iid-requests carrying one of its
+// keys, compared in constant time by their SHA-256 digests
+type StaticKeys map[string]Grant
+
+// Authorize implements Authorizer
+func (s StaticKeys) Authorize(r IidRequest) (Grant, bool) {
+	if r == nil || !r.HasKey() {
+		return Grant{}, false
+	}
+	key := sha256.Sum256([]byte(r.GetIidAuth()))
+	var grant Grant
+	found := 0
+	// compare the fixed-size digests with every key, so that the time taken
+	// reveals neither a match nor the length of a key
+	for k, g := range s {
+		d := sha256.Sum256([]byte(k))
+		if subtle.ConstantTimeCompare(d[:], key[:]) == 1 {
+			grant, found = g, 1
+		}
+	}
+	if found == 0 || grant.expired(time.Now()) {
+		return Grant{}, false
+	}
+	return grant, true
+}
+
+// Limit returns p capped to the scope granted by an Authorizer
+func (p DisclosurePolicy) Limit(scope Disclosure) DisclosurePolicy {
+	if scope == Shallow {
+		p.MaxDepth = 1
+	}
+	return p
+}
+
+// KeyFile is an Authorizer granting the iid-requests carrying a key whose
+// hash is listed in a file. Every line of the file lists a hash, the scope
+// "shallow" or "deep", optionally the expiry date in RFC 3339 or YYYY-MM-DD
+// format and optionally the hex encoded seal key prefixed by "seal:", see
+// Grant.SealKey, separated by spaces, e.g.
+//
+//	# SRE
+//	$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy deep seal:4f1c03e2a9b87d65f0e1d2c3b4a59687
+//	# partner, until end of 2026
+//	sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 shallow 2027-01-01
+//
+// A hash is either a bcrypt hash or the hex encoded SHA-256 hash prefixed by
+// "sha256:". Empty lines and lines starting with '#' are ignored. The file is
+// reloaded when it has changed, checked at most every ReloadInterval.
+type KeyFile struct {
+	// ReloadInterval is the minimal interval between checks whether the
+	// file has changed. Zero checks on every Authorize.
+	ReloadInterval time.Duration
+
+	path string
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTime  time.Time
+	size     int64
+	loads    int
+	keys     []hashedKey
+	verified map[[sha256.Size]byte]Grant
+	rejected map[[sha256.Size]byte]bool
+}
+
+// maxRejected bounds the number of rejected keys a KeyFile remembers
+const maxRejected = 1024
+
+type hashedKey struct {
+	hash  []byte
+	grant Grant
+}
+
+// NewKeyFile loads the hashed keys from the file at path, and reloads it
+// when it has changed at most every 10 seconds
+func NewKeyFile(path string) (*KeyFile, error) {
+	f := &KeyFile{path: path, ReloadInterval: 10 * time.Second}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload loads the hashed keys from the file. On error the keys loaded
+// before are kept.
+func (f *KeyFile) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reload()
+}
+
+func (f *KeyFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	keys, err := parseKeyFile(data)
+	if err != nil {
+		return errors.New("instanceid: " + f.path + ":" + err.Error())
+	}
+	f.keys, f.modTime, f.size = keys, info.ModTime(), info.Size()
+	f.loads++
+	f.verified = map[[sha256.Size]byte]Grant{}
+	f.rejected = map[[sha256.Size]byte]bool{}
+	return nil
+}
+
+// Authorize implements Authorizer. A bcrypt hash takes some milliseconds to
+// verify, keys once verified and the latest 1024 rejected keys are
+// remembered until the file is reloaded. Hashes are verified without
+// blocking concurrent iid-requests.
+func (f *KeyFile) Authorize(r IidRequest) (Grant, bool) {
+	if r == nil || !r.HasKey() {
+		return Grant{}, false
+	}
+	key := []byte(r.GetIidAuth())
+	sum := sha256.Sum256(key)
+
+	f.mu.Lock()
+	now := time.Now()
+	if now.Sub(f.checked) >= f.ReloadInterval {
+		f.checked = now
+		if info, err := os.Stat(f.path); err == nil && (!info.ModTime().Equal(f.modTime) || info.Size() != f.size) {
+			f.reload()
+		}
+	}
+	grant, ok := f.verified[sum]
+	rejected := f.rejected[sum]
+	keys, loads := f.keys, f.loads
+	f.mu.Unlock()
+
+	if !ok && !rejected {
+		// reload replaces the keys, so the snapshot is never modified
+		for _, k := range keys {
+			if k.matches(key, sum) {
+				grant, ok = k.grant, true
+				break
+			}
+		}
+		f.remember(loads, sum, grant, ok)
+	}
+	if !ok || grant.expired(now) {
+		return Grant{}, false
+	}
+	return grant, true
+}
+
+// remember records the result of verifying the key with the digest sum
+// against the keys of the given load, unless the file has been reloaded since
+func (f *KeyFile) remember(loads int, sum [sha256.Size]byte, grant Grant, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case loads != f.loads:
+	case ok:
+		f.verified[sum] = grant
+	default:
+		if len(f.rejected) >= maxRejected {
+			f.rejected = map[[sha256.Size]byte]bool{}
+		}
+		f.rejected[sum] = true
+	}
+}
+
+func (k hashedKey) matches(key []byte, sum [sha256.Size]byte) bool {
+	if bytes.HasPrefix(k.hash, []byte("$2")) {
+		return bcrypt.CompareHashAndPassword(k.hash, key) == nil
+	}
+	return subtle.ConstantTimeCompare(k.hash, sum[:]) == 1
+}
+
+func parseKeyFile(data []byte) (keys []hashedKey, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fail := func(reason string) ([]hashedKey, error) {
+			return nil, errors.New(strconv.Itoa(n) + ": " + reason)
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 4 {
+			return fail("expected hash, scope, optional expiry and seal key")
+		}
+
+		var k hashedKey
+		switch hash := fields[0]; {
+		case strings.HasPrefix(hash, "sha256:"):
+			if k.hash, err = hex.DecodeString(hash[len("sha256:"):]); err != nil || len(k.hash) != sha256.Size {
+				return fail("invalid SHA-256 hash")
+			}
+		case strings.HasPrefix(hash, "$2"):
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return fail("invalid bcrypt hash")
+			}
+			k.hash = []byte(hash)
+		default:
+			return fail("unknown hash " + strconv.Quote(hash))
+		}
+
+		switch fields[1] {
+		case Shallow.String():
+			k.grant.Scope = Shallow
+		case Deep.String():
+			k.grant.Scope = Deep
+		default:
+			return fail("unknown scope " + strconv.Quote(fields[1]))
+		}
+
+		for _, field := range fields[2:] {
+			switch {
+			case strings.HasPrefix(field, "seal:") && k.grant.SealKey == nil:
+				if k.grant.SealKey, err = hex.DecodeString(field[len("seal:"):]); err != nil || len(k.grant.SealKey) < MinSealKeySize {
+					return fail("invalid seal key")
+				}
+			case k.grant.Expires.IsZero():
+				if k.grant.Expires, err = parseExpiry(field); err != nil {
+					return fail("invalid expiry " + strconv.Quote(field))
+				}
+			default:
+				return fail("unexpected " + strconv.Quote(field))
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys, scanner.Err()
+}
+
+func parseExpiry(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
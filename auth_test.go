@@ -0,0 +1,194 @@
+package instanceid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type authorization struct {
+	request string
+	scope   Disclosure
+	ok      bool
+}
+
+func checkAuthorizations(t *testing.T, a Authorizer, tests []authorization) {
+	t.Helper()
+	for _, tt := range tests {
+		grant, ok := a.Authorize(NewIRequestFromString(tt.request))
+		if ok != tt.ok || (ok && grant.Scope != tt.scope) {
+			t.Errorf("Authorize(%v) = %v, %v, want %v, %v", tt.request, grant.Scope, ok, tt.scope, tt.ok)
+		}
+	}
+}
+
+func TestStaticKeys(t *testing.T) {
+	a := StaticKeys{
+		"sre":     {Scope: Deep},
+		"partner": {Scope: Shallow, Expires: time.Now().Add(time.Hour)},
+		"former":  {Scope: Deep, Expires: time.Now().Add(-time.Hour)},
+	}
+	checkAuthorizations(t, a, []authorization{
+		{"key=sre", Deep, true},
+		{"key=partner options=d", Shallow, true},
+		{"key=former", Deep, false},
+		{"key=sr", Deep, false},
+		{"empty", Deep, false},
+	})
+	if _, ok := a.Authorize(nil); ok {
+		t.Errorf("Authorize(nil) = true, want false")
+	}
+}
+
+func sha256Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func bcryptHash(t *testing.T, key string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "# SRE\n" +
+		bcryptHash(t, "sre") + " deep\n" +
+		"\n" +
+		sha256Hash("partner") + " shallow 2999-01-01\n" +
+		sha256Hash("former") + " deep 2001-01-01T00:00:00Z\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewKeyFile(path)
+	if err != nil {
+		t.Fatalf("NewKeyFile() error = %v", err)
+	}
+	a.ReloadInterval = 0
+	checkAuthorizations(t, a, []authorization{
+		{"key=sre", Deep, true},
+		{"key=sre", Deep, true},
+		{"key=partner", Shallow, true},
+		{"key=former", Deep, false},
+		{"key=unknown", Deep, false},
+		{"empty", Deep, false},
+	})
+
+	// hot reload
+	if err := os.WriteFile(path, []byte(sha256Hash("sre")+" shallow\n"+sha256Hash("new")+" deep\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	checkAuthorizations(t, a, []authorization{
+		{"key=sre", Shallow, true},
+		{"key=new", Deep, true},
+		{"key=partner", Deep, false},
+	})
+
+	// seal keys in any order after the scope
+	sealKey := "00112233445566778899aabbccddeeff"
+	if err := os.WriteFile(path, []byte(sha256Hash("a")+" deep seal:"+sealKey+"\n"+sha256Hash("b")+" deep seal:"+sealKey+" 2999-01-01\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if grant, ok := a.Authorize(NewIRequestFromString("key=" + key)); !ok || hex.EncodeToString(grant.SealKey) != sealKey {
+			t.Errorf("Authorize(key=%v) = %v, %v, want seal key %v", key, grant, ok, sealKey)
+		}
+	}
+
+	// invalid files are not loaded
+	if err := os.WriteFile(path, []byte("garbage deep\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err == nil {
+		t.Errorf("Reload() error = nil, want error")
+	}
+	checkAuthorizations(t, a, []authorization{{"key=a", Deep, true}})
+}
+
+func TestKeyFile_rejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(sha256Hash("sre")+" deep\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewKeyFile(path)
+	if err != nil {
+		t.Fatalf("NewKeyFile() error = %v", err)
+	}
+	a.ReloadInterval = time.Hour
+
+	checkAuthorizations(t, a, []authorization{{"key=new", Deep, false}})
+	if !a.rejected[sha256.Sum256([]byte("new"))] {
+		t.Errorf("rejected key not remembered")
+	}
+	for i := 0; i <= maxRejected; i++ {
+		a.Authorize(NewIRequestFromString("key=k" + strconv.Itoa(i)))
+	}
+	if got := len(a.rejected); got == 0 || got > maxRejected {
+		t.Errorf("%v rejected keys remembered, want at most %v", got, maxRejected)
+	}
+
+	// a comparison with the keys loaded before is not remembered
+	a.remember(a.loads-1, sha256.Sum256([]byte("stale")), Grant{}, false)
+	if a.rejected[sha256.Sum256([]byte("stale"))] {
+		t.Errorf("result of a reloaded file remembered")
+	}
+
+	// reloading forgets the rejected keys
+	if err := os.WriteFile(path, []byte(sha256Hash("new")+" deep\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	checkAuthorizations(t, a, []authorization{{"key=new", Deep, true}})
+}
+
+func TestNewKeyFile_errors(t *testing.T) {
+	tests := map[string]string{
+		"unknown hash":   "plain deep\n",
+		"invalid sha256": "sha256:abc deep\n",
+		"invalid bcrypt": "$2a$10$short deep\n",
+		"unknown scope":  sha256Hash("k") + " everything\n",
+		"invalid expiry": sha256Hash("k") + " deep tomorrow\n",
+		"too many":       sha256Hash("k") + " deep 2999-01-01 more\n",
+		"two expiries":   sha256Hash("k") + " deep 2999-01-01 2999-01-02\n",
+		"short seal key": sha256Hash("k") + " deep seal:00112233\n",
+		"invalid seal":   sha256Hash("k") + " deep seal:xyz\n",
+		"missing scope":  sha256Hash("k") + "\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys")
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewKeyFile(path); err == nil {
+				t.Errorf("NewKeyFile() error = nil, want error")
+			}
+		})
+	}
+	if _, err := NewKeyFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("NewKeyFile() error = nil for missing file, want error")
+	}
+}
+
+func TestDisclosurePolicy_Limit(t *testing.T) {
+	c := NewStdCiid("gw/1%1s(db/1%2s)")
+	r := NewIRequestFromString("key=k options=d")
+	if got := (DisclosurePolicy{}).Limit(Shallow).Disclose(r, c).String(); got != "gw/1%1s" {
+		t.Errorf("Limit(Shallow) = %v, want gw/1%%1s", got)
+	}
+	if got := (DisclosurePolicy{}).Limit(Deep).Disclose(r, c).String(); got != "gw/1%1s(db/1%2s)" {
+		t.Errorf("Limit(Deep) = %v, want gw/1%%1s(db/1%%2s)", got)
+	}
+}
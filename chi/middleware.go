@@ -0,0 +1,16 @@
+// Package chi makes go-chi/chi services IID aware. Middleware answers
+// iid-requests like nethttp.Middleware does for net/http services.
+package chi
+
+import (
+	"net/http"
+
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+// Middleware returns a chi middleware answering iid-requests, see
+// nethttp.Middleware. Handlers get the Recorder of the request with
+// iid.RecorderFrom.
+func Middleware(cfg nethttp.Config) func(http.Handler) http.Handler {
+	return nethttp.Middleware(cfg)
+}
@@ -0,0 +1,20 @@
+package chi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/theovassiliou/instanceidentification/internal/middlewaretest"
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+func TestMiddleware(t *testing.T) {
+	middlewaretest.Run(t, func(cfg nethttp.Config, h http.HandlerFunc) http.Handler {
+		r := chi.NewRouter()
+		r.Use(Middleware(cfg))
+		r.Get("/health", h)
+		return r
+	})
+}
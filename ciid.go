@@ -6,14 +6,37 @@ import (
 )
 
 type StdCiid struct {
-	miid  Miid
-	ciids Stack
+	miid      Miid
+	ciids     Stack
+	expected  bool
+	semantics CallSemantics
 }
 
 // NewCiid creates a new Ciid from a string in the form of
 // Sn1/Vn1/Va1%t1s(Sn2/Vn2/Va2%t2s+Sn3/Vn3/Va3%t3s(Sn4/Vn4/Va4%t4s))
+// Parse errors are ignored, use ParseCiid to detect them.
 func NewStdCiid(id string) (ciid *StdCiid) {
-	return parseCiid(id)
+	ciid, _ = ParseCiid(id)
+	return ciid
+}
+
+// ParseCiid creates a new Ciid like NewStdCiid, but reports the first
+// violation of the Ciid grammar as *ParseError. In case of an error the
+// returned Ciid holds what could be parsed, identical to NewStdCiid.
+func ParseCiid(id string) (*StdCiid, error) {
+	return ParseCiidWithOptions(id, ParserOptions{})
+}
+
+// ParseCiidWithOptions creates a new Ciid like ParseCiid, but stops parsing
+// as soon as one of the limits given in opts is exceeded. Use it with
+// DefaultParserOptions for Ciids received from untrusted sources.
+func ParseCiidWithOptions(id string, opts ParserOptions) (*StdCiid, error) {
+	p := ciidParser{in: id, opts: opts}
+	ciid := p.parse()
+	if p.err != nil {
+		return ciid, p.err
+	}
+	return ciid, nil
 }
 
 func (c StdCiid) Miid() Miid {
@@ -36,14 +59,33 @@ func (ciid *StdCiid) SetEpoch(startTime time.Time) Ciid {
 	return ciid
 }
 
-// String returns the textual representation of the Ciid
+// Expected returns true if the Ciid has been recorded by expectation, see
+// IsExpected
+func (c StdCiid) Expected() bool {
+	return c.expected
+}
+
+// Semantics returns the call semantics of the call graph, see Canonical
+func (c StdCiid) Semantics() CallSemantics {
+	return c.semantics
+}
+
+// String returns the textual representation of the Ciid, preceded by
+// ContactedMarker for Contacted semantics and ExpectedMarker if recorded by
+// expectation
 func (c StdCiid) String() string {
 	sB := strings.Builder{}
+	if c.semantics == Contacted {
+		sB.WriteString(ContactedMarker)
+	}
+	if c.expected {
+		sB.WriteString(ExpectedMarker)
+	}
 	sB.WriteString(c.miid.String())
 	if len(c.ciids) > 0 {
 		sB.WriteString("(")
 		for i, a := range c.ciids {
-			sB.WriteString(a.String())
+			sB.WriteString(callString(c.semantics, a))
 			if i+1 < len(c.ciids) {
 				sB.WriteString("+")
 			}
@@ -54,6 +96,17 @@ func (c StdCiid) String() string {
 	return sB.String()
 }
 
+// callString returns the textual representation of call within the call list
+// of a Ciid with the semantics s, preceded by ContactedMarker if the
+// semantics of call differ, see ContactedMarker
+func callString(s CallSemantics, call Ciid) string {
+	str := strings.TrimPrefix(call.String(), ContactedMarker)
+	if ownSemantics(s, call) {
+		return ContactedMarker + str
+	}
+	return str
+}
+
 // Contains returns true if the Ciid contains the left aligned miid as part of the call graph
 func (c StdCiid) Contains(miid string) bool {
 	if miid == "" {
@@ -63,94 +116,232 @@ func (c StdCiid) Contains(miid string) bool {
 }
 
 func parseCiid(id string) *StdCiid {
-	me := new(StdCiid)
-	name, arg := seperateFNameFromArg(id)
+	p := ciidParser{in: id}
+	return p.parse()
+}
 
-	me.miid = parseMIID(name)
+// ciidParser is a recursive-descent parser building the call graph of a Ciid
+// in a single pass over its bytes. It records the first violation of the
+// grammar in err, but continues with what can be parsed. If all is set every
+// violation is collected in violations.
+type ciidParser struct {
+	in         string
+	pos        int
+	path       []string
+	err        *ParseError
+	opts       ParserOptions
+	nodes      int
+	all        bool
+	violations []Violation
+}
 
-	if me.String() == "" || arg == "" {
-		// if me == "" we had a parse error, so for the rest don't care
-		return me
-	}
+// ciidNode allocates a StdCiid together with its StdMiid
+type ciidNode struct {
+	ciid StdCiid
+	miid StdMiid
+}
 
-	me.ciids = parseArguments(arg)
-	return me
+func (p *ciidParser) fail(kind ErrorKind, offset int, token string) {
+	if p.err != nil && !p.all {
+		return
+	}
+	v := Violation{
+		Offset: offset,
+		Token:  token,
+		Kind:   kind,
+		Path:   append([]string(nil), p.path...),
+	}
+	if p.all {
+		p.violations = append(p.violations, v)
+	}
+	if p.err == nil {
+		p.err = &ParseError{Input: p.in, Violation: v}
+	}
 }
 
-func seperateFNameFromArg(signature string) (name, arg string) {
-	n := strings.Builder{}
-	a := strings.Builder{}
-	var inArgs bool
-	var count int
-	for _, s := range signature {
-		if s == '(' {
-			count++
-			inArgs = true
-		}
-		if s == ')' {
-			count--
+// parse parses CIID and ensures that nothing but the CIID is given
+func (p *ciidParser) parse() *StdCiid {
+	if p.in == "" {
+		p.fail(KindEmpty, 0, "")
+		return &StdCiid{miid: new(StdMiid)}
+	}
+	if p.opts.MaxBytes > 0 && len(p.in) > p.opts.MaxBytes {
+		p.fail(KindTooLong, p.opts.MaxBytes, "")
+		return &StdCiid{miid: new(StdMiid)}
+	}
+
+	s := Called
+	if strings.HasPrefix(p.in, ContactedMarker) {
+		s = Contacted
+		p.pos += len(ContactedMarker)
+	}
+	c := p.ciid(s)
+	for p.pos < len(p.in) {
+		switch p.in[p.pos] {
+		case '+':
+			// simply concatenated Ciids do not form a Ciid
+			p.fail(KindUnexpectedPlus, p.pos, "+")
+			c = &StdCiid{miid: new(StdMiid)}
+			p.pos++
+			p.ciid(Called)
+		case ')':
+			p.fail(KindUnbalancedParenthesis, p.pos, ")")
+			p.pos++
+		default:
+			p.fail(KindUnexpectedToken, p.pos, p.in[p.pos:])
+			p.skip()
 		}
+	}
+	return c
+}
 
-		if !inArgs {
-			n.WriteRune(s)
-		} else if count == 1 && s != '(' {
-			a.WriteRune(s)
-		} else if count > 1 {
-			a.WriteRune(s)
+// ciid parses ["?"] MIID [ "(" UIDs ")" ] with the call semantics s
+// starting at the current position. The call list is dropped if the MIID is
+// invalid.
+func (p *ciidParser) ciid(s CallSemantics) *StdCiid {
+	n := new(ciidNode)
+	n.ciid.miid = &n.miid
+	n.ciid.semantics = s
+	p.nodes++
+
+	if strings.HasPrefix(p.in[p.pos:], ExpectedMarker) {
+		n.ciid.expected = true
+		p.pos += len(ExpectedMarker)
+	}
+	start := p.pos
+	for p.pos < len(p.in) && !isCiidDelimiter(p.in[p.pos]) {
+		p.pos++
+	}
+	token := p.in[start:p.pos]
+	valid := true
+	if p.opts.Strict {
+		for _, v := range validateMiid(token) {
+			p.fail(v.Kind, start+v.Offset, v.Token)
+			valid = false
+		}
+	}
+	if valid {
+		if err := scanMiid(&n.miid, token); err != nil {
+			p.fail(err.Kind, start+err.Offset, err.Token)
+			valid = false
+		} else if p.opts.MaxVaLength > 0 && len(n.miid.va) > p.opts.MaxVaLength {
+			va := strings.IndexByte(token, '/') + 1
+			va += strings.IndexByte(token[va:], '/') + 1
+			p.abort(KindVaTooLong, start+va, n.miid.va)
+			return &n.ciid
 		}
 	}
 
-	return n.String(), a.String()
-}
+	if p.pos == len(p.in) || p.in[p.pos] != '(' {
+		return &n.ciid
+	}
 
-func parseArguments(arg string) (ciids Stack) {
-	ss := splitOnPlus(arg)
+	if slash := strings.IndexByte(token, '/'); slash >= 0 {
+		token = token[:slash]
+	}
+	p.path = append(p.path, token)
+	p.callList(&n.ciid)
+	p.path = p.path[:len(p.path)-1]
 
-	for _, a := range ss {
-		ciids = append(ciids, parseCiid(a))
+	if !valid {
+		n.ciid.ciids = nil
 	}
-	return ciids
+	return &n.ciid
 }
 
-func splitOnPlus(s string) (ss []string) {
-	var openClose int
-	var splitPos []int
-
-	// first find parenthis pairs
-	for pos, char := range s {
-		if char == '(' {
-			openClose++
-		} else if char == ')' {
-			openClose--
-		} else if char == '+' {
-			if openClose == 0 {
-				splitPos = append(splitPos, pos)
+// callList parses "(" UIDs ")" and appends the UIDs to c. An operand
+// preceded by ContactedMarker toggles the semantics of c, other operands
+// inherit them. Empty operands are skipped, a missing ")" at the end of the
+// input is tolerated.
+func (p *ciidParser) callList(c *StdCiid) {
+	open := p.pos
+	p.pos++
+	expectOperand := true
+	for p.pos < len(p.in) {
+		switch p.in[p.pos] {
+		case ')':
+			if expectOperand {
+				p.fail(KindEmptyOperand, p.pos, ")")
 			}
+			p.pos++
+			return
+		case '+':
+			if expectOperand && p.pos+1 < len(p.in) && !isCiidDelimiter(p.in[p.pos+1]) {
+				// ContactedMarker of the operand
+				if !p.admit(len(c.ciids)) {
+					return
+				}
+				p.pos++
+				c.ciids = append(c.ciids, p.ciid(c.semantics.toggle()))
+				expectOperand = false
+				continue
+			}
+			if expectOperand {
+				p.fail(KindEmptyOperand, p.pos, "+")
+			}
+			p.pos++
+			expectOperand = true
+		default:
+			if !expectOperand {
+				// text following the call list of an operand, e.g. A(B(C)D)
+				p.fail(KindUnexpectedToken, p.pos, p.in[p.pos:p.pos+1])
+				p.skip()
+				continue
+			}
+			if !p.admit(len(c.ciids)) {
+				return
+			}
+			c.ciids = append(c.ciids, p.ciid(c.semantics))
+			expectOperand = false
 		}
 	}
+	p.fail(KindUnbalancedParenthesis, open, "(")
+}
 
-	//   split arguments
-	if len(splitPos) > 0 {
-		oldPos := -1
-		for _, s2 := range splitPos {
-			ss = append(ss, s[oldPos+1:s2])
-			oldPos = s2
-		}
-		ss = append(ss, s[oldPos+1:])
-	} else {
-		ss = append(ss, s)
+// admit reports whether another operand may be added to a call list already
+// holding the given number of children. Otherwise parsing is aborted.
+func (p *ciidParser) admit(children int) bool {
+	switch {
+	case p.opts.MaxDepth > 0 && len(p.path) >= p.opts.MaxDepth:
+		p.abort(KindTooDeep, p.pos, "")
+	case p.opts.MaxChildren > 0 && children >= p.opts.MaxChildren:
+		p.abort(KindTooManyChildren, p.pos, "")
+	case p.opts.MaxNodes > 0 && p.nodes >= p.opts.MaxNodes:
+		p.abort(KindTooManyNodes, p.pos, "")
+	default:
+		return true
 	}
-	return deleteEmpty(ss)
+	return false
 }
 
-func deleteEmpty(s []string) []string {
-	var r []string
-	for _, str := range s {
-		if str != "" {
-			r = append(r, str)
+// abort records the violation and skips the rest of the input
+func (p *ciidParser) abort(kind ErrorKind, offset int, token string) {
+	p.fail(kind, offset, token)
+	p.pos = len(p.in)
+}
+
+// skip advances to the next '+' or ')' on the current nesting level
+func (p *ciidParser) skip() {
+	var depth int
+	for ; p.pos < len(p.in); p.pos++ {
+		switch p.in[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return
+			}
+			depth--
+		case '+':
+			if depth == 0 {
+				return
+			}
 		}
 	}
-	return r
+}
+
+func isCiidDelimiter(b byte) bool {
+	return b == '(' || b == ')' || b == '+'
 }
 
 // -- Stack Implementation for StdCiid
@@ -177,12 +368,14 @@ func (s *Stack) Pop() (Ciid, bool) {
 	}
 }
 
-func (m StdCiid) SetStack(callStack Stack) StdCiid {
+// SetStack sets the call stack, like SetCiids. Chainable
+func (m *StdCiid) SetStack(callStack Stack) *StdCiid {
 	m.SetCiids(callStack)
 	return m
 }
 
-func (m StdCiid) ClearStack() StdCiid {
+// ClearStack removes all calls. Chainable
+func (m *StdCiid) ClearStack() *StdCiid {
 	m.SetCiids(nil)
 	return m
 }
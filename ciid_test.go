@@ -11,101 +11,6 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func Test_splitOnPlus(t *testing.T) {
-	type args struct {
-		s string
-	}
-	tests := []struct {
-		name string
-		args args
-		want []string
-	}{
-		{
-			"one plain arg",
-			args{" a"},
-			[]string{" a"},
-		},
-		{
-			"one plain arg with spaces",
-			args{" a"},
-			[]string{" a"},
-		},
-		{
-			"one plain arg longer name",
-			args{"someId"},
-			[]string{"someId"},
-		},
-		{
-			"two plain args",
-			args{"a+b"},
-			[]string{"a", "b"},
-		},
-		{
-			"two longer plain args",
-			args{"one+two"},
-			[]string{"one", "two"},
-		},
-
-		{
-			"three plain args",
-			args{"a+b+c"},
-			[]string{"a", "b", "c"},
-		},
-		{
-			"three longer args",
-			args{"one+two+three"},
-			[]string{"one", "two", "three"},
-		},
-		{
-			"three plain args with ()-1",
-			args{"a+b+c()"},
-			[]string{"a", "b", "c()"},
-		},
-		{
-			"4 plain args with",
-			args{"a+b+c+d"},
-			[]string{"a", "b", "c", "d"},
-		},
-		{
-			"three plain args with ()2",
-			args{"a+(b()+c)"},
-			[]string{"a", "(b()+c)"},
-		},
-		{
-			"three structured args with ()",
-			args{"a+(b()+c+ff(xx+zz))"},
-			[]string{"a", "(b()+c+ff(xx+zz))"},
-		},
-		{
-			"nested sum",
-			args{"(a+b)"},
-			[]string{"(a+b)"},
-		},
-		{
-			"2 nested sum",
-			args{"(x+y)+(a+b)"},
-			[]string{"(x+y)", "(a+b)"},
-		},
-		{
-			"invalid +",
-			args{"+a"},
-			[]string{"a"},
-		},
-		{
-			"invalid postfix+",
-			args{"a+"},
-			[]string{"a"},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := splitOnPlus(tt.args.s); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("splitOnPlus() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func Test_parseCiid(t *testing.T) {
 	log.SetLevel(log.TraceLevel)
 
@@ -291,64 +196,6 @@ func Test_parseCiid(t *testing.T) {
 	}
 }
 
-func Test_seperateFNameFromArg(t *testing.T) {
-	type args struct {
-		signature string
-	}
-	tests := []struct {
-		name     string
-		args     args
-		wantName string
-		wantArg  string
-	}{
-		{
-			"simple",
-			args{"A(B)"},
-			"A",
-			"B",
-		},
-		{
-			"no Arg",
-			args{"A"},
-			"A", "",
-		},
-		{
-			"empty Parenthesis",
-			args{"A()"},
-			"A",
-			"",
-		},
-		{
-			"no name",
-			args{"(B)"},
-			"",
-			"B",
-		},
-		{
-			"more complex",
-			args{"A(B+C)"},
-			"A",
-			"B+C",
-		},
-		{
-			"more complex, neste functions",
-			args{"A(B(D)+C(E(F)))"},
-			"A",
-			"B(D)+C(E(F))",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			gotName, gotArg := seperateFNameFromArg(tt.args.signature)
-			if gotName != tt.wantName {
-				t.Errorf("seperateFNameFromArg() gotName = %v, want %v", gotName, tt.wantName)
-			}
-			if gotArg != tt.wantArg {
-				t.Errorf("seperateFNameFromArg() gotArg = %v, want %v", gotArg, tt.wantArg)
-			}
-		})
-	}
-}
 func TestCiid_String(t *testing.T) {
 	tests := []struct {
 		name string
@@ -725,3 +572,61 @@ func TestInvalidCiid(t *testing.T) {
 	}
 
 }
+
+// deepCiid returns a call chain of depth services, each calling the next one
+func deepCiid(depth int) string {
+	sB := strings.Builder{}
+	for i := 0; i < depth; i++ {
+		if i > 0 {
+			sB.WriteString("(")
+		}
+		fmt.Fprintf(&sB, "ms%d/1.%d/dev-%x%%%ds", i, i, i*4711, i)
+	}
+	sB.WriteString(strings.Repeat(")", depth-1))
+	return sB.String()
+}
+
+// wideCiid returns a service calling width services, each calling width services
+// down to the given depth
+func wideCiid(width, depth int) string {
+	sB := strings.Builder{}
+	fmt.Fprintf(&sB, "ms%d/1.%d/dev-%x%%%ds", depth, width, depth*4711, depth)
+	if depth > 1 {
+		sB.WriteString("(")
+		for i := 0; i < width; i++ {
+			if i > 0 {
+				sB.WriteString("+")
+			}
+			sB.WriteString(wideCiid(width, depth-1))
+		}
+		sB.WriteString(")")
+	}
+	return sB.String()
+}
+
+func BenchmarkParseCiid(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		id   string
+	}{
+		{"miid", deepCiid(1)},
+		{"deep-10", deepCiid(10)},
+		{"deep-100", deepCiid(100)},
+		{"deep-1000", deepCiid(1000)},
+		{"wide-10", wideCiid(10, 2)},
+		{"wide-100", wideCiid(100, 2)},
+		{"wide-1000", wideCiid(1000, 2)},
+		{"tree-5x4", wideCiid(5, 4)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bm.id)))
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseCiid(bm.id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
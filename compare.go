@@ -0,0 +1,230 @@
+package instanceid
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EqualOption configures the comparison of Equal and Diff
+type EqualOption func(*equalConfig)
+
+type equalConfig struct {
+	ignoreEpochs bool
+	ignoreVa     bool
+	unordered    bool
+}
+
+// IgnoreEpochs compares Miids without their epochs
+func IgnoreEpochs() EqualOption {
+	return func(c *equalConfig) { c.ignoreEpochs = true }
+}
+
+// IgnoreVa compares Miids without their Va
+func IgnoreVa() EqualOption {
+	return func(c *equalConfig) { c.ignoreVa = true }
+}
+
+// Unordered compares the calls of a Ciid regardless of their order, as
+// reported by services enumerating contacted services. Without it Diff
+// reports calls in a different order as Reordered.
+func Unordered() EqualOption {
+	return func(c *equalConfig) { c.unordered = true }
+}
+
+func newEqualConfig(opts []EqualOption) *equalConfig {
+	cfg := new(equalConfig)
+	for _, o := range opts {
+		o(cfg)
+	}
+	return cfg
+}
+
+// Equal returns true if a and b describe the same call graph. Unlike
+// comparing String() or using Contains, Miids are compared field by field.
+func Equal(a, b Ciid, opts ...EqualOption) bool {
+	cfg := newEqualConfig(opts)
+	return cfg.canonical(a) == cfg.canonical(b)
+}
+
+// miid returns the textual representation of m without the fields ignored
+func (cfg *equalConfig) miid(m Miid) string {
+	sB := strings.Builder{}
+	sB.WriteString(EscapeName(m.Sn()) + "/" + EscapeName(m.Vn()))
+	if !cfg.ignoreVa {
+		sB.WriteString("/" + EscapeVa(m.Va()))
+	}
+	if !cfg.ignoreEpochs {
+		sB.WriteString("%" + strconv.Itoa(m.T()) + "s")
+	}
+	return sB.String()
+}
+
+// canonical returns the textual representation of c without the fields
+// ignored and calls sorted if unordered
+func (cfg *equalConfig) canonical(c Ciid) string {
+	calls := make([]string, 0, len(c.Ciids()))
+	for _, call := range c.Ciids() {
+		calls = append(calls, cfg.canonical(call))
+	}
+	if cfg.unordered {
+		sort.Strings(calls)
+	}
+	return cfg.miid(c.Miid()) + "(" + strings.Join(calls, "+") + ")"
+}
+
+// ChangeKind classifies a Change
+type ChangeKind int
+
+const (
+	// Added reports a call present only in the second Ciid
+	Added ChangeKind = iota + 1
+
+	// Removed reports a call present only in the first Ciid
+	Removed
+
+	// Changed reports a service present in both Ciids with different Vn, Va or epoch
+	Changed
+
+	// Reordered reports a service calling the same services in a different
+	// order, unless compared Unordered
+	Reordered
+)
+
+// String returns the name of the change kind
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	case Reordered:
+		return "reordered"
+	}
+	return "ChangeKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Change describes a difference between two call graphs
+type Change struct {
+	Kind ChangeKind
+
+	// Path lists the service names from the outermost Ciid down to the
+	// added, removed or changed service
+	Path []string
+
+	// From is the service in the first Ciid, nil if Added
+	From Miid
+
+	// To is the service in the second Ciid, nil if Removed
+	To Miid
+}
+
+// String returns the textual representation of the change, e.g.
+// "changed gateway/database: database/1.1%3s -> database/1.2%3s"
+func (c Change) String() string {
+	sB := strings.Builder{}
+	sB.WriteString(c.Kind.String() + " " + strings.Join(c.Path, "/") + ": ")
+	if c.From != nil {
+		sB.WriteString(c.From.String())
+	}
+	if c.From != nil && c.To != nil {
+		sB.WriteString(" -> ")
+	}
+	if c.To != nil {
+		sB.WriteString(c.To.String())
+	}
+	return sB.String()
+}
+
+// Diff returns the changes turning the call graph a into b. Calls are
+// matched to equal calls first and to calls of the same service name
+// otherwise, in the order of the calls. Calls of added or removed services
+// are not reported separately.
+func Diff(a, b Ciid, opts ...EqualOption) (changes []Change) {
+	cfg := newEqualConfig(opts)
+	return cfg.diff(nil, a, b, changes)
+}
+
+func (cfg *equalConfig) diff(path []string, a, b Ciid, changes []Change) []Change {
+	path = append(path[:len(path):len(path)], b.Miid().Sn())
+	if cfg.miid(a.Miid()) != cfg.miid(b.Miid()) {
+		changes = append(changes, Change{Kind: Changed, Path: path, From: a.Miid(), To: b.Miid()})
+	}
+
+	callsA, callsB := a.Ciids(), b.Ciids()
+	match := cfg.match(callsA, callsB)
+	if !cfg.unordered {
+		last := -1
+		for _, j := range match {
+			if j < 0 {
+				continue
+			}
+			if j < last {
+				changes = append(changes, Change{Kind: Reordered, Path: path, From: a.Miid(), To: b.Miid()})
+				break
+			}
+			last = j
+		}
+	}
+
+	matched := make([]bool, len(callsB))
+	for i, callA := range callsA {
+		j := match[i]
+		if j < 0 {
+			changes = append(changes, Change{
+				Kind: Removed,
+				Path: append(path[:len(path):len(path)], callA.Miid().Sn()),
+				From: callA.Miid(),
+			})
+			continue
+		}
+		matched[j] = true
+		changes = cfg.diff(path, callA, callsB[j], changes)
+	}
+
+	for i, callB := range callsB {
+		if !matched[i] {
+			changes = append(changes, Change{
+				Kind: Added,
+				Path: append(path[:len(path):len(path)], callB.Miid().Sn()),
+				To:   callB.Miid(),
+			})
+		}
+	}
+	return changes
+}
+
+// match returns for every call in a the index of the matching call in b, or
+// -1. Equal calls are matched first, then calls with the same service name.
+func (cfg *equalConfig) match(a, b Stack) []int {
+	match := make([]int, len(a))
+	matched := make([]bool, len(b))
+	canonicalB := make([]string, len(b))
+	for j, callB := range b {
+		canonicalB[j] = cfg.canonical(callB)
+	}
+	for i, callA := range a {
+		match[i] = -1
+		canonicalA := cfg.canonical(callA)
+		for j := range b {
+			if !matched[j] && canonicalA == canonicalB[j] {
+				match[i], matched[j] = j, true
+				break
+			}
+		}
+	}
+	for i, callA := range a {
+		if match[i] >= 0 {
+			continue
+		}
+		for j, callB := range b {
+			if !matched[j] && callA.Miid().Sn() == callB.Miid().Sn() {
+				match[i], matched[j] = j, true
+				break
+			}
+		}
+	}
+	return match
+}
@@ -0,0 +1,146 @@
+package instanceid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		opts []EqualOption
+		want bool
+	}{
+		{"identical", walkCiid, walkCiid, nil, true},
+		{"version prefix", "msA/1.1%1s", "msA/1.10%1s", nil, false},
+		{"epochs", "gw/1%1s(db/1%2s)", "gw/1%11s(db/1%12s)", nil, false},
+		{"ignore epochs", "gw/1%1s(db/1%2s)", "gw/1%11s(db/1%12s)", []EqualOption{IgnoreEpochs()}, true},
+		{"va", "gw/1/a%1s", "gw/1/b%1s", nil, false},
+		{"ignore va", "gw/1/a%1s", "gw/1/b%1s", []EqualOption{IgnoreVa()}, true},
+		{"ignore va, not version", "gw/1/a%1s", "gw/2/b%1s", []EqualOption{IgnoreVa()}, false},
+		{"order", "gw/1%1s(a/1%1s+b/1%1s)", "gw/1%1s(b/1%1s+a/1%1s)", nil, false},
+		{"unordered", "gw/1%1s(a/1%1s+b/1%1s)", "gw/1%1s(b/1%1s+a/1%1s)", []EqualOption{Unordered()}, true},
+		{"unordered nested", "gw/1%1s(a/1%1s(c/1%1s+d/1%1s)+b/1%1s)", "gw/1%1s(b/1%1s+a/1%1s(d/1%1s+c/1%1s))", []EqualOption{Unordered()}, true},
+		{"unordered repeated", "gw/1%1s(a/1%1s+a/1%1s+b/1%1s)", "gw/1%1s(b/1%1s+a/1%1s+b/1%1s)", []EqualOption{Unordered()}, false},
+		{"call moved", "gw/1%1s(a/1%1s(b/1%1s))", "gw/1%1s(a/1%1s+b/1%1s)", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Equal(NewStdCiid(tt.a), NewStdCiid(tt.b), tt.opts...); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		opts []EqualOption
+		want []string
+	}{
+		{
+			"identical",
+			walkCiid, walkCiid, nil,
+			nil,
+		},
+		{
+			"version bump",
+			"gateway/1%1s(database/1.1%3s(storage/0.2%7s)+monitoring/1%1s)",
+			"gateway/1%1s(database/1.2%3s(storage/0.2%7s)+monitoring/1%1s)",
+			nil,
+			[]string{"changed gateway/database: database/1.1%3s -> database/1.2%3s"},
+		},
+		{
+			"epochs ignored",
+			"gateway/1%1s(database/1.1%3s(storage/0.2%7s))",
+			"gateway/1%9s(database/1.1%8s(storage/0.3%9s))",
+			[]EqualOption{IgnoreEpochs()},
+			[]string{"changed gateway/database/storage: storage/0.2%7s -> storage/0.3%9s"},
+		},
+		{
+			"added and removed",
+			"gateway/1%1s(database/1.1%3s+cache/1%1s)",
+			"gateway/1%1s(database/1.1%3s(storage/0.2%7s)+search/2%2s)",
+			nil,
+			[]string{
+				"added gateway/database/storage: storage/0.2%7s",
+				"removed gateway/cache: cache/1%1s",
+				"added gateway/search: search/2%2s",
+			},
+		},
+		{
+			"reordered",
+			"gateway/1%1s(a/1%1s+b/1%1s)",
+			"gateway/1%1s(b/1%1s+a/2%1s)",
+			nil,
+			[]string{
+				"reordered gateway: gateway/1%1s -> gateway/1%1s",
+				"changed gateway/a: a/1%1s -> a/2%1s",
+			},
+		},
+		{
+			"reordered unordered",
+			"gateway/1%1s(a/1%1s+b/1%1s)",
+			"gateway/1%1s(b/1%1s+a/2%1s)",
+			[]EqualOption{Unordered()},
+			[]string{"changed gateway/a: a/1%1s -> a/2%1s"},
+		},
+		{
+			"repeated service reordered",
+			"gateway/1%1s(a/1%1s+a/2%2s)",
+			"gateway/1%1s(a/2%2s+a/1%1s)",
+			nil,
+			[]string{"reordered gateway: gateway/1%1s -> gateway/1%1s"},
+		},
+		{
+			"repeated service unordered",
+			"gateway/1%1s(a/1%1s+a/2%2s)",
+			"gateway/1%1s(a/2%2s+a/1%1s)",
+			[]EqualOption{Unordered()},
+			nil,
+		},
+		{
+			"repeated service changed",
+			"gateway/1%1s(a/1%1s+a/2%2s+a/3%3s)",
+			"gateway/1%1s(a/3%3s+a/1%1s+a/4%2s)",
+			[]EqualOption{Unordered()},
+			[]string{"changed gateway/a: a/2%2s -> a/4%2s"},
+		},
+		{
+			"different root",
+			"gateway/1%1s",
+			"proxy/1%1s",
+			nil,
+			[]string{"changed proxy: gateway/1%1s -> proxy/1%1s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range Diff(NewStdCiid(tt.a), NewStdCiid(tt.b), tt.opts...) {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff_paths(t *testing.T) {
+	changes := Diff(
+		NewStdCiid("gateway/1%1s(database/1.1%3s)"),
+		NewStdCiid("gateway/1%1s(database/1.2%3s)"),
+	)
+	if len(changes) != 1 {
+		t.Fatalf("Diff() = %v, want one change", changes)
+	}
+	c := changes[0]
+	if c.Kind != Changed || !reflect.DeepEqual(c.Path, []string{"gateway", "database"}) ||
+		c.From.Vn() != "1.1" || c.To.Vn() != "1.2" {
+		t.Errorf("Diff() = %#v, want version change under gateway/database", c)
+	}
+}
@@ -0,0 +1,112 @@
+package instanceid
+
+import "strconv"
+
+// Disclosure defines how much of its call graph a service discloses
+type Disclosure int
+
+const (
+	// Deep discloses the Miid of the service and the Ciids of the services
+	// it has called
+	Deep Disclosure = iota
+
+	// Shallow discloses the Miid of the service only
+	Shallow
+)
+
+// String returns the name of the disclosure
+func (d Disclosure) String() string {
+	switch d {
+	case Deep:
+		return "deep"
+	case Shallow:
+		return "shallow"
+	}
+	return "Disclosure(" + strconv.Itoa(int(d)) + ")"
+}
+
+// VaDisclosure defines whether a service discloses the Va of the Miids
+type VaDisclosure int
+
+const (
+	// DiscloseVa discloses Va
+	DiscloseVa VaDisclosure = iota
+
+	// DiscloseVaOnRequest discloses Va to iid-requests with OptionVa only
+	DiscloseVaOnRequest
+
+	// RedactVa never discloses Va
+	RedactVa
+)
+
+// DisclosurePolicy decides which part of the recorded call graph a service
+// discloses in response to an iid-request. The zero value discloses the
+// complete call graph, unless requested otherwise.
+type DisclosurePolicy struct {
+	// Default is the disclosure for iid-requests with neither OptionShallow
+	// nor OptionDeep. An iid-request with OptionShallow is always answered
+	// shallow.
+	Default Disclosure
+
+	// MaxDepth truncates the disclosed call graph to MaxDepth levels, the
+	// Miid of the service being the first. Zero is unlimited.
+	MaxDepth int
+
+	// Va defines whether Va is disclosed
+	Va VaDisclosure
+
+	// Semantics are the call semantics of the disclosed call graph. An
+	// iid-request with OptionContacted is always answered with Contacted.
+	Semantics CallSemantics
+}
+
+// Disclose returns the part of the call graph c disclosed in response to the
+// iid-request r, as copy. c is not modified.
+func (p DisclosurePolicy) Disclose(r IidRequest, c Ciid) Ciid {
+	depth := 0
+	if p.disclosure(r) == Shallow {
+		depth = 1
+	}
+	if p.MaxDepth > 0 && (depth == 0 || p.MaxDepth < depth) {
+		depth = p.MaxDepth
+	}
+	redact := p.Va == RedactVa || (p.Va == DiscloseVaOnRequest && !HasOption(r, OptionVa))
+
+	s := SemanticsOf(c)
+	if p.Semantics == Contacted || HasOption(r, OptionContacted) {
+		s = Contacted
+	}
+	d := disclose(Canonical(c, s), depth, redact)
+	d.semantics = s
+	return d
+}
+
+// disclosure returns the disclosure requested by r
+func (p DisclosurePolicy) disclosure(r IidRequest) Disclosure {
+	switch {
+	case HasOption(r, OptionShallow):
+		return Shallow
+	case HasOption(r, OptionDeep):
+		return Deep
+	}
+	return p.Default
+}
+
+// disclose copies c down to depth levels, zero being unlimited, without Va if
+// redact is set
+func disclose(c Ciid, depth int, redact bool) *StdCiid {
+	n := copyCiid(c)
+	if redact {
+		n.miid.(*StdMiid).va = ""
+	}
+	if depth == 1 {
+		return n
+	}
+	if depth > 1 {
+		depth--
+	}
+	for _, call := range c.Ciids() {
+		n.ciids = append(n.ciids, disclose(call, depth, redact))
+	}
+	return n
+}
@@ -0,0 +1,52 @@
+package instanceid
+
+import "testing"
+
+func TestDisclosurePolicy_Disclose(t *testing.T) {
+	const id = "gw/1.1/eu%1s(db/1.2/main-ab12%2s(storage/0.2%3s)+mon/1.1%4s+db/1.2/main-ab12%5s)"
+	tests := []struct {
+		name    string
+		policy  DisclosurePolicy
+		request string
+		want    string
+	}{
+		{"deep", DisclosurePolicy{}, "empty", id},
+		{"shallow requested", DisclosurePolicy{}, "empty options=s", "gw/1.1/eu%1s"},
+		{"shallow wins", DisclosurePolicy{}, "empty options=ds", "gw/1.1/eu%1s"},
+		{"shallow default", DisclosurePolicy{Default: Shallow}, "empty", "gw/1.1/eu%1s"},
+		{"deep requested", DisclosurePolicy{Default: Shallow}, "empty options=d", id},
+		{"truncated", DisclosurePolicy{MaxDepth: 2}, "empty", "gw/1.1/eu%1s(db/1.2/main-ab12%2s+mon/1.1%4s+db/1.2/main-ab12%5s)"},
+		{"truncated shallow", DisclosurePolicy{MaxDepth: 2}, "empty options=s", "gw/1.1/eu%1s"},
+		{"Va redacted", DisclosurePolicy{Va: RedactVa}, "empty options=v", "gw/1.1%1s(db/1.2%2s(storage/0.2%3s)+mon/1.1%4s+db/1.2%5s)"},
+		{"Va not requested", DisclosurePolicy{Va: DiscloseVaOnRequest}, "empty", "gw/1.1%1s(db/1.2%2s(storage/0.2%3s)+mon/1.1%4s+db/1.2%5s)"},
+		{"Va requested", DisclosurePolicy{Va: DiscloseVaOnRequest}, "empty options=v", id},
+		{"contacted requested", DisclosurePolicy{}, "empty options=c", "+gw/1.1/eu%1s(db/1.2/main-ab12%2s(storage/0.2%3s)+mon/1.1%4s)"},
+		{"contacted policy", DisclosurePolicy{Semantics: Contacted, MaxDepth: 2}, "empty", "+gw/1.1/eu%1s(db/1.2/main-ab12%2s+mon/1.1%4s)"},
+		{"no request", DisclosurePolicy{}, "", id},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewStdCiid(id)
+			var r IidRequest
+			if tt.request != "" {
+				r = NewIRequestFromString(tt.request)
+			}
+			if got := tt.policy.Disclose(r, c); got.String() != tt.want {
+				t.Errorf("Disclose() = %v, want %v", got, tt.want)
+			}
+			if c.String() != id {
+				t.Errorf("Disclose() modified the recorded Ciid to %v", c)
+			}
+		})
+	}
+}
+
+func TestDisclosurePolicy_keepsMarks(t *testing.T) {
+	c := NewCiidBuilder(NewStdMiid("gw/1%1s")).
+		Call(NewCiidBuilder(NewExternalMiid("api", "https://api")).Build().WithExpected(true)).
+		Build()
+	d := DisclosurePolicy{Va: RedactVa}.Disclose(nil, c)
+	if got := d.String(); got != "gw/1%1s(?api/x%0s)" || !IsExpected(d.Ciids()[0]) {
+		t.Errorf("Disclose() = %v, want ?api/x%%0s recorded by expectation", got)
+	}
+}
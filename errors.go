@@ -0,0 +1,158 @@
+package instanceid
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ErrorKind names the grammar rule a ParseError reports as violated
+type ErrorKind int
+
+const (
+	// KindEmpty reports an empty instance id, or an empty Miid within a Ciid
+	KindEmpty ErrorKind = iota + 1
+
+	// KindMissingName reports a Miid without a service name, e.g. "/1.1%1s"
+	KindMissingName
+
+	// KindMissingVersion reports a Miid without a version number, e.g.
+	// "HelloWorld" or "DE.TU-BERLIN.ECHO//main-352e3bf/397s"
+	KindMissingVersion
+
+	// KindMissingPercent reports a Miid without the '%' introducing the epoch,
+	// e.g. "msa/1.1/additionalinformation/2s"
+	KindMissingPercent
+
+	// KindMissingSuffix reports an epoch not terminated by 's', e.g. "msa/1.1%1"
+	KindMissingSuffix
+
+	// KindInvalidEpoch reports an epoch that is not a signed integer, e.g. "msa/1.1%xs"
+	KindInvalidEpoch
+
+	// KindUnbalancedParenthesis reports a '(' without matching ')' or vice versa
+	KindUnbalancedParenthesis
+
+	// KindEmptyOperand reports an empty call list or an empty '+' operand,
+	// e.g. "msa/1.1%1s()" or "msa/1.1%1s(msb/1%1s+)"
+	KindEmptyOperand
+
+	// KindUnexpectedPlus reports a '+' outside of a call list, i.e. two Ciids
+	// simply concatenated, e.g. "msa/1.1%1s+msb/1.1%1s"
+	KindUnexpectedPlus
+
+	// KindUnexpectedToken reports a character that may not appear at the
+	// given position, e.g. text following the closing ')' of a Ciid
+	KindUnexpectedToken
+
+	// KindUnknownElement reports an iid-request element other than empty, key or options
+	KindUnknownElement
+
+	// KindEmptyKey reports an iid-request "key=" element without value
+	KindEmptyKey
+
+	// KindInvalidOption reports an iid-request option that is not a letter
+	KindInvalidOption
+
+	// KindTooLong reports an input longer than ParserOptions.MaxBytes
+	KindTooLong
+
+	// KindTooDeep reports a call graph nested deeper than ParserOptions.MaxDepth
+	KindTooDeep
+
+	// KindTooManyChildren reports a call list longer than ParserOptions.MaxChildren
+	KindTooManyChildren
+
+	// KindTooManyNodes reports a call graph with more Ciids than ParserOptions.MaxNodes
+	KindTooManyNodes
+
+	// KindVaTooLong reports a Va longer than ParserOptions.MaxVaLength
+	KindVaTooLong
+
+	// KindInvalidName reports a service name with a character outside of the
+	// <sN> character class. Only reported in strict mode.
+	KindInvalidName
+
+	// KindInvalidVersion reports a version number with a character outside of
+	// the <vN> character class. Only reported in strict mode.
+	KindInvalidVersion
+
+	// KindInvalidVa reports an empty Va or a Va with a character outside of the
+	// <vA> character class. Only reported in strict mode.
+	KindInvalidVa
+)
+
+var kindNames = map[ErrorKind]string{
+	KindEmpty:                 "empty instance id",
+	KindMissingName:           "missing service name",
+	KindMissingVersion:        "missing version",
+	KindMissingPercent:        "missing '%' before epoch",
+	KindMissingSuffix:         "missing trailing 's' after epoch",
+	KindInvalidEpoch:          "non-numeric epoch",
+	KindUnbalancedParenthesis: "unbalanced parenthesis",
+	KindEmptyOperand:          "empty '+' operand",
+	KindUnexpectedPlus:        "'+' outside of a call list",
+	KindUnexpectedToken:       "unexpected character",
+	KindUnknownElement:        "unknown iid-request element",
+	KindEmptyKey:              "empty key value",
+	KindInvalidOption:         "invalid option",
+	KindTooLong:               "maximum length exceeded",
+	KindTooDeep:               "maximum depth exceeded",
+	KindTooManyChildren:       "maximum number of calls exceeded",
+	KindTooManyNodes:          "maximum number of services exceeded",
+	KindVaTooLong:             "maximum Va length exceeded",
+	KindInvalidName:           "invalid service name",
+	KindInvalidVersion:        "invalid version",
+	KindInvalidVa:             "invalid Va",
+}
+
+// String returns a human readable description of the violated rule
+func (k ErrorKind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return "ErrorKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Violation describes a single violation of the Ciid, Miid or iid-request grammar
+type Violation struct {
+	// Offset is the byte offset into the input where the violation has been detected
+	Offset int
+
+	// Token is the offending part of the input
+	Token string
+
+	// Kind is the violated grammar rule
+	Kind ErrorKind
+
+	// Path lists the service names of the Ciids enclosing the violation,
+	// outermost first. Empty for violations at top level.
+	Path []string
+}
+
+// String returns the textual representation of the violation
+func (v Violation) String() string {
+	sB := strings.Builder{}
+	sB.WriteString(v.Kind.String())
+	sB.WriteString(" at offset ")
+	sB.WriteString(strconv.Itoa(v.Offset))
+	if v.Token != "" {
+		sB.WriteString(" near " + strconv.Quote(v.Token))
+	}
+	if len(v.Path) > 0 {
+		sB.WriteString(" in " + strings.Join(v.Path, "/"))
+	}
+	return sB.String()
+}
+
+// ParseError describes why an instance id or an iid-request could not be parsed
+type ParseError struct {
+	// Input is the complete string that has been parsed
+	Input string
+
+	Violation
+}
+
+// Error returns the textual representation of the parse error
+func (e *ParseError) Error() string {
+	return "instanceid: " + e.Violation.String()
+}
@@ -0,0 +1,156 @@
+package instanceid
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseCiid_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		wantKind   ErrorKind
+		wantOffset int
+		wantPath   []string
+	}{
+		// -- cases of test/iidtestsetInvalid.txt
+		{"concatenated with call list", "MsA/1.1/xxx%22s+msB/2.0.1/yyyy%444s+(msC/1.4%5555s+msD/2.2%23234s)", KindUnexpectedPlus, 15, nil},
+		{"concatenated", "MsA/1.1/xxx%22s+msB/2.0.1/yyyy%444s", KindUnexpectedPlus, 15, nil},
+		{"no structure", "HelloWorld", KindMissingVersion, 10, nil},
+		{"no structure with spaces", "This is a test", KindMissingVersion, 14, nil},
+		{"no %, trailing s", "msa/1.1/additionalinformation/2s", KindMissingPercent, 32, nil},
+		{"no %, trailing number", "msa/1.1/additionalinformation/1", KindMissingPercent, 31, nil},
+		{"no %, non-numeric", "msa/1.1/additionalinformation/xs", KindMissingPercent, 32, nil},
+		{"no epoch", "msa/1.1/additionalinformation", KindMissingPercent, 29, nil},
+		{"no trailing s", "msa/1.1/additionalinformation%1", KindMissingSuffix, 31, nil},
+		{"non-numeric epoch", "msa/1.1/additionalinformation%xs", KindInvalidEpoch, 30, nil},
+		{"missing version", "DE.TU-BERLIN.ECHO//main-352e3bf/397s", KindMissingVersion, 18, nil},
+
+		// -- structural errors
+		{"empty", "", KindEmpty, 0, nil},
+		{"missing name", "/1.1%1s", KindMissingName, 0, nil},
+		{"missing nested name", "a/1%1s(/1%1s)", KindMissingName, 7, []string{"a"}},
+		{"unclosed", "a/1%1s(b/1%1s", KindUnbalancedParenthesis, 6, []string{"a"}},
+		{"unclosed nested", "a/1%1s(b/1%1s(c/1%1s)", KindUnbalancedParenthesis, 6, []string{"a"}},
+		{"unopened", "a/1%1s(b/1%1s))", KindUnbalancedParenthesis, 14, nil},
+		{"empty call list", "a/1%1s()", KindEmptyOperand, 7, []string{"a"}},
+		{"empty leading operand", "a/1%1s(++b/1%1s)", KindEmptyOperand, 7, []string{"a"}},
+		{"empty trailing operand", "a/1%1s(b/1%1s+)", KindEmptyOperand, 14, []string{"a"}},
+		{"trailing text", "a/1%1s(b/1%1s)c", KindUnexpectedToken, 14, nil},
+		{"nested epoch", "a/1%1s(b/1%1s(c/1%xs))", KindInvalidEpoch, 18, []string{"a", "b"}},
+		{"nested second operand", "a/1%1s(b/1%1s+c/1%1s(d/1.1))", KindMissingPercent, 26, []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCiid(tt.id)
+			var pErr *ParseError
+			if !errors.As(err, &pErr) {
+				t.Fatalf("ParseCiid() error = %v, want *ParseError", err)
+			}
+			if pErr.Kind != tt.wantKind {
+				t.Errorf("ParseCiid() kind = %v, want %v", pErr.Kind, tt.wantKind)
+			}
+			if pErr.Offset != tt.wantOffset {
+				t.Errorf("ParseCiid() offset = %v, want %v", pErr.Offset, tt.wantOffset)
+			}
+			if len(pErr.Path) != 0 || len(tt.wantPath) != 0 {
+				if !reflect.DeepEqual(pErr.Path, tt.wantPath) {
+					t.Errorf("ParseCiid() path = %v, want %v", pErr.Path, tt.wantPath)
+				}
+			}
+			if pErr.Input != tt.id {
+				t.Errorf("ParseCiid() input = %v, want %v", pErr.Input, tt.id)
+			}
+		})
+	}
+}
+
+func TestParseCiid_lenient(t *testing.T) {
+	tests := []string{
+		"",
+		"msa/1.1%1",
+		"A/1.1%22s(B/1.1%22s(C/1.1%22s+D/1.1%22s)+D/1.1%22s(E/1.1%22s)",
+		"MsA/1.1/xxx%22s(msC/1.4%5555s+msD/2.2%23234s)",
+	}
+	for _, id := range tests {
+		t.Run(id, func(t *testing.T) {
+			got, _ := ParseCiid(id)
+			if want := NewStdCiid(id); !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseCiid() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseMiid_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		wantKind ErrorKind
+	}{
+		{"valid", "msA/1.17/dev-123ab%3333s", 0},
+		{"valid short", "msA/1.17%-1s", 0},
+		{"missing suffix", "msA/1.17%3333", KindMissingSuffix},
+		{"invalid epoch", "msA/1.17%333as", KindInvalidEpoch},
+		{"call list", "msA/1.17%3s(msB/1%1s)", KindUnexpectedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMiid(tt.id)
+			if tt.wantKind == 0 {
+				if err != nil {
+					t.Errorf("ParseMiid() error = %v, want nil", err)
+				}
+				return
+			}
+			if pErr, ok := err.(*ParseError); !ok || pErr.Kind != tt.wantKind {
+				t.Errorf("ParseMiid() error = %v, want %v", err, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestParseIRequest_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		v          string
+		wantKind   ErrorKind
+		wantOffset int
+	}{
+		{"empty", "empty", 0, 0},
+		{"empty;", "empty;", 0, 0},
+		{"key and options", "key=asdf options=vc", 0, 0},
+		{"no input", "", KindEmpty, 0},
+		{"unknown", "asdf", KindUnknownElement, 0},
+		{"unknown second", "empty asdf", KindUnknownElement, 6},
+		{"empty key", "key=", KindEmptyKey, 0},
+		{"invalid option", "empty options=v1", KindInvalidOption, 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIRequest(tt.v)
+			if want := NewIRequestFromString(tt.v); !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseIRequest() = %v, want %v", got, want)
+			}
+			if tt.wantKind == 0 {
+				if err != nil {
+					t.Errorf("ParseIRequest() error = %v, want nil", err)
+				}
+				return
+			}
+			pErr, ok := err.(*ParseError)
+			if !ok || pErr.Kind != tt.wantKind || pErr.Offset != tt.wantOffset {
+				t.Errorf("ParseIRequest() error = %#v, want %v at %v", err, tt.wantKind, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestParseError_Error(t *testing.T) {
+	_, err := ParseCiid("a/1%1s(b/1%1s(c/1%xs))")
+	want := `instanceid: non-numeric epoch at offset 18 near "x" in a/b`
+	if err == nil || err.Error() != want {
+		t.Errorf("ParseError.Error() = %v, want %v", err, want)
+	}
+}
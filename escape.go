@@ -0,0 +1,107 @@
+package instanceid
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Characters reserved by the Ciid grammar within <sN>/<vN> and <vA>
+const (
+	reservedName = "/%+()?"
+	reservedVa   = "%+()"
+)
+
+const upperhex = "0123456789ABCDEF"
+
+// EscapeName escapes s for use as <sN> or <vN> of a Miid. Every byte of
+// the reserved characters '/', '%', '+', '(', ')' and '?', of white space, of
+// non-printable characters and of invalid UTF-8 is replaced by '%'
+// followed by two upper case hex digits, e.g. "a+b" becomes "a%2Bb".
+// StdMiid.String applies it automatically.
+func EscapeName(s string) string {
+	return escape(s, reservedName)
+}
+
+// EscapeVa escapes s for use as <vA> of a Miid like EscapeName, but keeps
+// '/'. StdMiid.String applies it automatically.
+func EscapeVa(s string) string {
+	return escape(s, reservedVa)
+}
+
+// Unescape reverses EscapeName and EscapeVa. A '%' not followed by two hex
+// digits is kept literally. Parsing a Miid applies it automatically.
+func Unescape(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return s
+	}
+
+	sB := strings.Builder{}
+	sB.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && isEscape(s[i:]) {
+			sB.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		sB.WriteByte(s[i])
+	}
+	return sB.String()
+}
+
+func escape(s, reserved string) string {
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if mustEscape(r, size, reserved) {
+			break
+		}
+		i += size
+	}
+	if i == len(s) {
+		return s
+	}
+
+	sB := strings.Builder{}
+	sB.Grow(len(s) + 8)
+	sB.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !mustEscape(r, size, reserved) {
+			sB.WriteString(s[i : i+size])
+		} else {
+			for _, b := range []byte(s[i : i+size]) {
+				sB.WriteByte('%')
+				sB.WriteByte(upperhex[b>>4])
+				sB.WriteByte(upperhex[b&15])
+			}
+		}
+		i += size
+	}
+	return sB.String()
+}
+
+func mustEscape(r rune, size int, reserved string) bool {
+	return r == utf8.RuneError && size <= 1 ||
+		!unicode.IsGraphic(r) || unicode.IsSpace(r) ||
+		strings.ContainsRune(reserved, r)
+}
+
+// isEscape returns true if s starts with '%' followed by two hex digits
+func isEscape(s string) bool {
+	return len(s) >= 3 && s[0] == '%' && isHex(s[1]) && isHex(s[2])
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
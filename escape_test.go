@@ -0,0 +1,87 @@
+package instanceid
+
+import (
+	"testing"
+	"testing/quick"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		wantName string
+		wantVa   string
+	}{
+		{"plain", "feature-branch-2345abcd", "feature-branch-2345abcd", "feature-branch-2345abcd"},
+		{"unicode", "中€ä", "中€ä", "中€ä"},
+		{"slash", "feature/x", "feature%2Fx", "feature/x"},
+		{"reserved", "a+b(c)%d", "a%2Bb%28c%29%25d", "a%2Bb%28c%29%25d"},
+		{"question mark", "a?b", "a%3Fb", "a?b"},
+		{"space", "a b\t", "a%20b%09", "a%20b%09"},
+		{"invalid utf-8", "a\xffb", "a%FFb", "a%FFb"},
+		{"empty", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EscapeName(tt.in); got != tt.wantName {
+				t.Errorf("EscapeName() = %v, want %v", got, tt.wantName)
+			}
+			if got := EscapeVa(tt.in); got != tt.wantVa {
+				t.Errorf("EscapeVa() = %v, want %v", got, tt.wantVa)
+			}
+			if got := Unescape(tt.wantName); got != tt.in {
+				t.Errorf("Unescape() = %v, want %v", got, tt.in)
+			}
+		})
+	}
+}
+
+func TestUnescape_invalid(t *testing.T) {
+	tests := map[string]string{
+		"100%":   "100%",
+		"%2":     "%2",
+		"%zz":    "%zz",
+		"%2f%2F": "//",
+	}
+	for in, want := range tests {
+		if got := Unescape(in); got != want {
+			t.Errorf("Unescape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMiid_escapeRoundTrip(t *testing.T) {
+	f := func(sn, vn, va string, epoch int) bool {
+		if sn == "" || vn == "" {
+			return true
+		}
+		m := &StdMiid{sn: sn, vn: vn, va: va, t: epoch}
+		s := m.String()
+		if vs := Validate(s); vs != nil {
+			t.Logf("Validate(%q) = %v", s, vs)
+			return false
+		}
+		got, err := ParseMiid(s)
+		return err == nil && *got == *m
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCiid_escapeRoundTrip(t *testing.T) {
+	f := func(names []string) bool {
+		c := &StdCiid{miid: &StdMiid{sn: "root", vn: "1"}}
+		for i, n := range names {
+			if n == "" {
+				continue
+			}
+			c.ciids.Push(&StdCiid{miid: &StdMiid{sn: n, vn: n, va: n, t: i}})
+		}
+		got, err := ParseCiidWithOptions(c.String(), ParserOptions{Strict: true})
+		return err == nil && got.String() == c.String() && len(got.Ciids()) == len(c.Ciids())
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,17 +1,70 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 
 	iid "github.com/theovassiliou/instanceidentification"
 )
 
+// usage: cmdline [open <sealed ciid> <hex seal key> | <ciid>] [dot|mermaid|plantuml|query <expr>]
 func main() {
 
-	instanceId := os.Args[1]
+	args := os.Args[1:]
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: cmdline [open <sealed ciid> <hex seal key> | <ciid>] [dot|mermaid|plantuml|query <expr>]")
+		os.Exit(2)
+	}
 
-	ciid := iid.NewStdCiid(instanceId)
+	var ciid *iid.StdCiid
+	if args[0] == "open" {
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: cmdline open <sealed ciid> <hex seal key>")
+			os.Exit(2)
+		}
+		key, err := hex.DecodeString(args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid seal key:", err)
+			os.Exit(2)
+		}
+		if ciid, err = iid.Open(args[1], key); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		args = args[2:]
+	} else {
+		ciid = iid.NewStdCiid(args[0])
+	}
 	fmt.Println(ciid.String())
-	fmt.Println(ciid.TreePrint())
+
+	format := ""
+	if len(args) > 1 {
+		format = args[1]
+	}
+
+	opts := iid.RenderOptions{Ordered: true}
+	switch format {
+	case "dot":
+		fmt.Print(iid.RenderDOT(ciid, opts))
+	case "mermaid":
+		fmt.Print(iid.RenderMermaid(ciid, opts))
+	case "plantuml":
+		fmt.Print(iid.RenderPlantUML(ciid, opts))
+	case "query":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: cmdline <ciid> query <expr>")
+			os.Exit(2)
+		}
+		found, err := iid.Query(ciid, args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, c := range found {
+			fmt.Println(c.String())
+		}
+	default:
+		fmt.Println(ciid.TreePrint())
+	}
 }
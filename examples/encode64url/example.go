@@ -9,16 +9,20 @@ import (
 
 	"github.com/theovassiliou/base64url"
 	iid "github.com/theovassiliou/instanceidentification"
+	iidgin "github.com/theovassiliou/instanceidentification/gin"
+	"github.com/theovassiliou/instanceidentification/nethttp"
 )
 
 // Default MIID of this service
 const THISSERVICE = "encode64url/0.1%-1s"
 
 var startTime time.Time
-var thisServiceCIID iid.Ciid
+
+// thisServiceCIID is shared by all requests, WithEpoch returns a copy
+var thisServiceCIID iid.ImmutableCiid
 
 func init() {
-	thisServiceCIID = iid.NewStdCiid(THISSERVICE)
+	thisServiceCIID = iid.Freeze(iid.NewStdCiid(THISSERVICE))
 	startTime = time.Now()
 }
 
@@ -26,7 +30,7 @@ func main() {
 
 	r := gin.Default()
 	r.LoadHTMLGlob("templates/*")
-	r.Use(GenerateInstanceId())
+	r.Use(iidgin.Middleware(nethttp.Config{Miid: thisServiceCIID.Miid(), StartTime: startTime}))
 
 	r.GET("/", func(c *gin.Context) {
 		c.HTML(
@@ -34,7 +38,7 @@ func main() {
 			"index.html",
 			gin.H{
 				"title":       "Home Page",
-				"xinstanceid": thisServiceCIID.SetEpoch(startTime).String(),
+				"xinstanceid": thisServiceCIID.WithEpoch(startTime).String(),
 			},
 		)
 
@@ -46,7 +50,7 @@ func main() {
 		if exists {
 			c.JSON(200, gin.H{
 				"encodedstring": base64url.Encode([]byte(s)),
-				"x-instance-id": thisServiceCIID.SetEpoch(startTime).String(),
+				"x-instance-id": thisServiceCIID.WithEpoch(startTime).String(),
 			})
 		}
 	})
@@ -55,7 +59,7 @@ func main() {
 		b, exists := c.GetPostForm("stringtodecode")
 		if exists {
 			s, _ := base64url.Decode(b)
-			xiid := thisServiceCIID.SetEpoch(startTime)
+			xiid := thisServiceCIID.WithEpoch(startTime)
 			c.JSON(200, gin.H{
 				"decodedstring": string(s),
 				"x-instance-id": xiid.String(),
@@ -68,7 +72,7 @@ func main() {
 	r.POST("/verify", func(c *gin.Context) {
 		s, exists := c.GetPostForm("stringtoencode")
 		if exists {
-			xiid := thisServiceCIID.SetEpoch(startTime)
+			xiid := thisServiceCIID.WithEpoch(startTime)
 			fmt.Printf("%#v", xiid.Miid())
 			encoded := base64url.Encode([]byte(s))
 			encodedDecoded, _ := base64url.Decode(encoded)
@@ -88,24 +92,3 @@ func main() {
 
 	r.Run() // listen and serve on 0.0.0.0:8080
 }
-
-func GenerateInstanceId() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		writer := &CiidResponseWriter{c.Writer, iid.NewStdCiid(THISSERVICE)}
-		c.Writer = writer
-		c.Next()
-	}
-}
-
-type CiidResponseWriter struct {
-	gin.ResponseWriter
-	Ciid iid.Ciid
-}
-
-func (w *CiidResponseWriter) WriteHeader(code int) {
-	if w.Header().Get(iid.XINSTANCEID) == "" {
-		w.Header().Add(iid.XINSTANCEID, w.Ciid.SetEpoch(startTime).String())
-	}
-
-	w.ResponseWriter.WriteHeader(code)
-}
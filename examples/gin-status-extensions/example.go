@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -12,6 +11,8 @@ import (
 	ix "github.com/theovassiliou/instanceidentification/examples/gin-status-extensions/instanceidextended"
 
 	iid "github.com/theovassiliou/instanceidentification"
+	iidgin "github.com/theovassiliou/instanceidentification/gin"
+	"github.com/theovassiliou/instanceidentification/nethttp"
 )
 
 var thisServiceCIID iid.Ciid
@@ -37,7 +38,11 @@ func main() {
 
 	r := gin.Default()
 
-	r.Use(GenerateInstanceId())
+	r.Use(iidgin.Middleware(nethttp.Config{
+		Miid:       thisServiceCIID.Miid(),
+		StartTime:  startTime,
+		Authorizer: authorizer,
+	}))
 
 	// -- Example returning only default MIID as CIID
 	r.GET("/status", func(c *gin.Context) {
@@ -49,14 +54,12 @@ func main() {
 
 	// -- Example returning a simple call-graph
 	r.GET("/health", func(c *gin.Context) {
-		ciid := thisServiceCIID
-		var callStack = ciid.Ciids()
-
-		callStack.Push(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
-		callStack.Push(iid.NewStdCiid("monitoring/1.1%22242s"))
-		ciid.SetCiids(callStack).SetEpoch(startTime)
-		c.Header(iid.XINSTANCEID, ciid.String())
-		log.Println("We called the following services:", ciid.(*iid.StdCiid).TreePrint())
+		// the Ciids returned by the called services are recorded per request
+		if rec := iidgin.FromContext(c); rec != nil {
+			rec.Record(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+			rec.Record(iid.NewStdCiid("monitoring/1.1%22242s"))
+			log.Println("We called the following services:", rec.Ciid().(*iid.StdCiid).TreePrint())
+		}
 
 		c.JSON(200, gin.H{
 			"health": "degraded",
@@ -66,51 +69,5 @@ func main() {
 	r.Run() // listen and serve on 0.0.0.0:8080
 }
 
-func GenerateInstanceId() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if c.Request.Header[iid.XINSTANCEID] != nil {
-			ir := iid.NewIRequestFromString(strings.Join(c.Request.Header[iid.XINSTANCEID], " "))
-			log.Println("X-Instance-Id header included:\n")
-			log.Printf("The canonical-header: %v", ir.GetHeader())
-
-			if ir.HasKey() && checkAuthorisationKey(ir) {
-				log.Println("Authorisation key valid")
-				writer := &CiidResponseWriter{c.Writer, ix.NewExtCiid(cmdName, version, branch, commit)}
-				c.Writer = writer
-			} else {
-				log.Println("Authorisation key NOT VALID")
-
-			}
-
-		} else {
-			log.Printf("No X-Instance-Id header included\n")
-		}
-
-		c.Next()
-	}
-}
-
-func checkAuthorisationKey(ir iid.IidRequest) bool {
-	if ir.GetIidAuth() == "masterkey" {
-		return true
-	}
-
-	return false
-}
-
-type CiidResponseWriter struct {
-	gin.ResponseWriter
-	Ciid iid.Ciid
-}
-
-func (w *CiidResponseWriter) WriteHeader(code int) {
-
-	if w.Header().Get(iid.XINSTANCEID) == "" {
-		fmt.Println(w.Ciid)
-		w.Ciid.SetEpoch(startTime)
-		fmt.Println(w.Ciid)
-		w.Header().Add(iid.XINSTANCEID, w.Ciid.String())
-	}
-
-	w.ResponseWriter.WriteHeader(code)
-}
+// authorizer grants the keys entitled to the call graph
+var authorizer iid.Authorizer = iid.StaticKeys{"masterkey": {Scope: iid.Deep}}
@@ -16,13 +16,13 @@ func NewExtCiid(a, v, b, c string) instanceid.Ciid {
 		branchB.WriteString("/")
 	}
 	if b != "" {
-		branchB.WriteString(b)
+		branchB.WriteString(instanceid.EscapeVa(b))
 	}
 
 	if c != "" {
 		branchB.WriteString("-")
-		branchB.WriteString(c)
+		branchB.WriteString(instanceid.EscapeVa(c))
 	}
 
-	return instanceid.NewStdCiid(a + "/" + v + branchB.String() + "%-1s")
+	return instanceid.NewStdCiid(instanceid.EscapeName(a) + "/" + instanceid.EscapeName(v) + branchB.String() + "%-1s")
 }
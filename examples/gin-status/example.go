@@ -8,6 +8,8 @@ import (
 	"github.com/gin-gonic/gin"
 
 	iid "github.com/theovassiliou/instanceidentification"
+	iidgin "github.com/theovassiliou/instanceidentification/gin"
+	"github.com/theovassiliou/instanceidentification/nethttp"
 )
 
 // Default MIID of this service
@@ -25,7 +27,7 @@ func main() {
 
 	r := gin.Default()
 
-	r.Use(GenerateInstanceId())
+	r.Use(iidgin.Middleware(nethttp.Config{Miid: thisServiceCIID.Miid(), StartTime: startTime}))
 
 	// -- Example returning only default MIID as CIID
 	r.GET("/status", func(c *gin.Context) {
@@ -36,14 +38,12 @@ func main() {
 
 	// -- Example returning a simple call-graph
 	r.GET("/health", func(c *gin.Context) {
-		ciid := thisServiceCIID
-		var callStack = ciid.Ciids()
-
-		callStack.Push(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
-		callStack.Push(iid.NewStdCiid("monitoring/1.1%22242s"))
-		ciid.SetCiids(callStack).SetEpoch(startTime)
-		c.Header(iid.XINSTANCEID, ciid.String())
-		log.Println("We called the following services:", ciid.(*iid.StdCiid).TreePrint())
+		// the Ciids returned by the called services are recorded per request
+		if rec := iidgin.FromContext(c); rec != nil {
+			rec.Record(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+			rec.Record(iid.NewStdCiid("monitoring/1.1%22242s"))
+			log.Println("We called the following services:", rec.Ciid().(*iid.StdCiid).TreePrint())
+		}
 
 		c.JSON(200, gin.H{
 			"health": "degraded",
@@ -52,24 +52,3 @@ func main() {
 
 	r.Run() // listen and serve on 0.0.0.0:8080
 }
-
-func GenerateInstanceId() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		writer := &CiidResponseWriter{c.Writer, iid.NewStdCiid(THISSERVICE)}
-		c.Writer = writer
-		c.Next()
-	}
-}
-
-type CiidResponseWriter struct {
-	gin.ResponseWriter
-	Ciid iid.Ciid
-}
-
-func (w *CiidResponseWriter) WriteHeader(code int) {
-	if w.Header().Get(iid.XINSTANCEID) == "" {
-		w.Header().Add(iid.XINSTANCEID, w.Ciid.SetEpoch(startTime).String())
-	}
-
-	w.ResponseWriter.WriteHeader(code)
-}
@@ -8,6 +8,8 @@ import (
 	"github.com/gorilla/mux"
 
 	iid "github.com/theovassiliou/instanceidentification"
+	iidgorilla "github.com/theovassiliou/instanceidentification/gorilla"
+	"github.com/theovassiliou/instanceidentification/nethttp"
 )
 
 // Default MIID of this service
@@ -26,10 +28,8 @@ type Status struct {
 	Status string
 }
 
-// Writing simple X-Instance-Id header, via Middleware
+// Writing simple X-Instance-Id header
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
-	thisServiceCIID.SetCiids(iid.Stack{})
-
 	stat := Status{"status", "running"}
 	js, err := json.Marshal(stat)
 	if err != nil {
@@ -49,46 +49,21 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Header.Get(iid.XINSTANCEID) != "" {
-
-		var callStack = thisServiceCIID.Ciids()
-		callStack.Push(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
-		callStack.Push(iid.NewStdCiid("monitoring/1.1%22242s"))
-		thisServiceCIID.SetCiids(callStack).SetEpoch(startTime)
-		w.Header().Del(iid.XINSTANCEID)
-		w.Header().Add(iid.XINSTANCEID, thisServiceCIID.String())
-		thisServiceCIID.SetCiids(iid.Stack{})
-	}
+	// the Ciids returned by the called services are recorded per request,
+	// the middleware adds them to the X-Instance-Id header
+	rec := iid.RecorderFrom(r.Context())
+	rec.Record(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+	rec.Record(iid.NewStdCiid("monitoring/1.1%22242s"))
 
 	w.Write(js)
 }
 
 func main() {
 
-	r := CiidRouter{
-		mux.NewRouter(),
-		thisServiceCIID,
-	}
-	r.Use(InstanceIdMiddleware(&r))
+	r := mux.NewRouter()
+	r.Use(iidgorilla.Middleware(nethttp.Config{Miid: thisServiceCIID.Miid(), StartTime: startTime}))
 	r.HandleFunc("/status", StatusHandler)
 	r.HandleFunc("/health", HealthHandler)
 
 	http.ListenAndServe(":8080", r)
 }
-
-type CiidRouter struct {
-	*mux.Router
-	Ciid iid.Ciid
-}
-
-func InstanceIdMiddleware(r *CiidRouter) mux.MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			// We only want to reply with the header if requested
-			if req.Header.Get(iid.XINSTANCEID) != "" {
-				w.Header().Add(iid.XINSTANCEID, r.Ciid.SetEpoch(startTime).String())
-			}
-			next.ServeHTTP(w, req)
-		})
-	}
-}
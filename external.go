@@ -0,0 +1,40 @@
+package instanceid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/theovassiliou/base64url"
+)
+
+// ExternalVn is the version number of services that do not disclose their
+// identity, see NewExternalMiid
+const ExternalVn = "x"
+
+// NewExternalMiid creates a Miid for a service that does not disclose its
+// identity, e.g. an external service, recorded by expectation. sn is a
+// descriptive service name, the version number is ExternalVn and Va is the
+// base64url encoded target, e.g. the called url. Targets too long for the
+// MaxVaLength of DefaultParserOptions are shortened to a prefix and a hash of
+// the target. The epoch is unknown and 0.
+func NewExternalMiid(sn, target string) *StdMiid {
+	m := &StdMiid{sn: sn, vn: ExternalVn}
+	if target != "" {
+		m.va = base64url.Encode([]byte(shortTarget(target)))
+	}
+	return m
+}
+
+// maxTarget is the length of the longest target encoded within MaxVaLength
+var maxTarget = DefaultParserOptions.MaxVaLength * 3 / 4
+
+// shortTarget returns target, or its prefix and hash if it is longer than
+// maxTarget
+func shortTarget(target string) string {
+	if len(target) <= maxTarget {
+		return target
+	}
+	sum := sha256.Sum256([]byte(target))
+	hash := "#" + hex.EncodeToString(sum[:8])
+	return target[:maxTarget-len(hash)] + hash
+}
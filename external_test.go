@@ -0,0 +1,39 @@
+package instanceid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/theovassiliou/base64url"
+)
+
+func TestNewExternalMiid(t *testing.T) {
+	tests := []struct {
+		sn     string
+		target string
+		want   string
+	}{
+		{"de.wikiquote.org", "https://de.wikiquote.org/wiki/Kleobulos_von_Lindos", "de.wikiquote.org/x/aHR0cHM6Ly9kZS53aWtpcXVvdGUub3JnL3dpa2kvS2xlb2J1bG9zX3Zvbl9MaW5kb3M%0s"},
+		{"www.google.com", "https://www.google.com/search?q=example+query", "www.google.com/x/aHR0cHM6Ly93d3cuZ29vZ2xlLmNvbS9zZWFyY2g_cT1leGFtcGxlK3F1ZXJ5%0s"},
+		{"postgres", "", "postgres/x%0s"},
+		{
+			"long",
+			"https://example.com/" + strings.Repeat("a", 200),
+			"long/x/" + base64url.Encode([]byte("https://example.com/"+strings.Repeat("a", 59)+"#fbe873ba66dc28a1")) + "%0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sn, func(t *testing.T) {
+			got := NewExternalMiid(tt.sn, tt.target)
+			if got.String() != tt.want {
+				t.Errorf("NewExternalMiid() = %v, want %v", got, tt.want)
+			}
+			if _, err := ParseCiidWithOptions(got.String(), DefaultParserOptions); err != nil {
+				t.Errorf("NewExternalMiid() = %v, want within DefaultParserOptions: %v", got, err)
+			}
+			if len(Validate(got.String())) != 0 {
+				t.Errorf("NewExternalMiid() = %v, want valid Miid", got)
+			}
+		})
+	}
+}
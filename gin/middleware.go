@@ -0,0 +1,70 @@
+// Package gin makes gin services IID aware. Middleware answers iid-requests
+// like nethttp.Middleware does for net/http services.
+package gin
+
+import (
+	"bufio"
+	"net"
+
+	"github.com/gin-gonic/gin"
+
+	iid "github.com/theovassiliou/instanceidentification"
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+// Middleware returns a gin middleware answering iid-requests, see
+// nethttp.Middleware. Handlers get the Recorder of the request with
+// FromContext.
+func Middleware(cfg nethttp.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, e := cfg.Start(c.Request)
+		if e == nil {
+			c.Next()
+			return
+		}
+
+		c.Request = r
+		c.Writer = &responseWriter{ResponseWriter: c.Writer, exchange: e}
+		c.Next()
+		e.SetHeader(c.Writer.Header())
+	}
+}
+
+// FromContext returns the Recorder of the request, or nil if the request
+// carries no authorised iid-request
+func FromContext(c *gin.Context) *iid.Recorder {
+	return iid.RecorderFrom(c.Request.Context())
+}
+
+// responseWriter sets the X-Instance-Id header before the header is written.
+// gin defers writing the header set by WriteHeader to the first write.
+type responseWriter struct {
+	gin.ResponseWriter
+	exchange *nethttp.Exchange
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	w.exchange.SetHeader(w.Header())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.exchange.SetHeader(w.Header())
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.exchange.SetHeader(w.Header())
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseWriter) Flush() {
+	w.exchange.SetHeader(w.Header())
+	w.ResponseWriter.Flush()
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// the connection is taken over, there is no header to be written
+	w.exchange.Abandon()
+	return w.ResponseWriter.Hijack()
+}
@@ -0,0 +1,115 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	iid "github.com/theovassiliou/instanceidentification"
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve serves a request with the iid-request value through an engine using
+// Middleware
+func serve(cfg nethttp.Config, request string, h gin.HandlerFunc) *httptest.ResponseRecorder {
+	cfg.Miid = iid.NewStdMiid("ourService/1.1%-1s")
+	cfg.StartTime = time.Now()
+	r := gin.New()
+	r.Use(Middleware(cfg))
+	r.GET("/health", h)
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	if request != "" {
+		req.Header.Set(iid.XINSTANCEID, request)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func health(c *gin.Context) {
+	rec := FromContext(c)
+	rec.Record(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+	rec.Record(iid.NewStdCiid("monitoring/1.1%22242s"))
+	// the header is written with the body
+	c.Status(http.StatusAccepted)
+	rec.Record(iid.NewStdCiid("cache/1%1s"))
+	c.JSON(http.StatusAccepted, gin.H{"health": "degraded"})
+	// calls recorded after the header has been written are lost
+	rec.Record(iid.NewStdCiid("late/1%1s"))
+}
+
+func TestMiddleware(t *testing.T) {
+	const deep = "ourService/1.1%0s(database/1.2%33s(storageService/0.2%77s)+monitoring/1.1%22242s+cache/1%1s)"
+	tests := []struct {
+		name    string
+		cfg     nethttp.Config
+		request string
+		want    string
+	}{
+		{"not requested", nethttp.Config{}, "", ""},
+		{"empty", nethttp.Config{}, "empty", deep},
+		{"key", nethttp.Config{Authorizer: iid.StaticKeys{"abc": {}}}, "key=abc", deep},
+		{"wrong key", nethttp.Config{Authorizer: iid.StaticKeys{"abc": {}}}, "key=abd", ""},
+		{"shallow key", nethttp.Config{Authorizer: iid.StaticKeys{"abc": {Scope: iid.Shallow}}}, "key=abc options=d", "ourService/1.1%0s"},
+		{"shallow", nethttp.Config{}, "empty options=s", "ourService/1.1%0s"},
+		{"contacted", nethttp.Config{}, "empty options=c", "+ourService/1.1%0s(cache/1%1s+database/1.2%33s(storageService/0.2%77s)+monitoring/1.1%22242s)"},
+		{"sealed without key", nethttp.Config{Seal: true}, "empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.cfg, tt.request, health)
+			if got := w.Header().Get(iid.XINSTANCEID); got != tt.want {
+				t.Errorf("X-Instance-Id = %v, want %v", got, tt.want)
+			}
+			if w.Code != http.StatusAccepted || w.Body.String() != `{"health":"degraded"}` {
+				t.Errorf("response = %v %v, want %v", w.Code, w.Body, http.StatusAccepted)
+			}
+		})
+	}
+}
+
+func TestMiddleware_sealed(t *testing.T) {
+	sealKey := []byte("0123456789abcdef")
+	w := serve(nethttp.Config{Authorizer: iid.StaticKeys{"abc": {Scope: iid.Deep, SealKey: sealKey}}}, "key=abc options=e", health)
+	c, err := iid.Open(w.Header().Get(iid.XINSTANCEID), sealKey)
+	if err != nil || c.Miid().Sn() != "ourService" || len(c.Ciids()) != 3 {
+		t.Errorf("Open() = %v, %v, want ourService with 3 calls", c, err)
+	}
+}
+
+func TestMiddleware_noWrite(t *testing.T) {
+	w := serve(nethttp.Config{}, "empty", func(c *gin.Context) {
+		FromContext(c).Record(iid.NewStdCiid("db/1%1s"))
+	})
+	if got, want := w.Header().Get(iid.XINSTANCEID), "ourService/1.1%0s(db/1%1s)"; got != want {
+		t.Errorf("X-Instance-Id = %v, want %v", got, want)
+	}
+}
+
+func TestMiddleware_abort(t *testing.T) {
+	w := serve(nethttp.Config{}, "empty", func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusTeapot)
+		FromContext(c).Record(iid.NewStdCiid("late/1%1s"))
+	})
+	if got, want := w.Header().Get(iid.XINSTANCEID), "ourService/1.1%0s"; got != want || w.Code != http.StatusTeapot {
+		t.Errorf("response = %v %v, want %v %v", w.Code, got, http.StatusTeapot, want)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var got *iid.Recorder
+	serve(nethttp.Config{}, "", func(c *gin.Context) {
+		got = FromContext(c)
+	})
+	if got != nil {
+		t.Errorf("FromContext() = %v, want nil without iid-request", got)
+	}
+}
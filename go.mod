@@ -4,9 +4,10 @@ go 1.16
 
 require (
 	github.com/gin-gonic/gin v1.7.1
-	github.com/gorilla/mux v1.8.0 // indirect
+	github.com/go-chi/chi/v5 v5.0.0
+	github.com/gorilla/mux v1.8.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/theovassiliou/base64url v0.0.0-20211006203958-1e011490eaaf
 	github.com/xlab/treeprint v1.1.0
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	golang.org/x/crypto v0.14.0
 )
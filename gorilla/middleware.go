@@ -0,0 +1,16 @@
+// Package gorilla makes gorilla/mux services IID aware. Middleware answers
+// iid-requests like nethttp.Middleware does for net/http services.
+package gorilla
+
+import (
+	"github.com/gorilla/mux"
+
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+// Middleware returns a mux.MiddlewareFunc answering iid-requests, see
+// nethttp.Middleware. Handlers get the Recorder of the request with
+// iid.RecorderFrom.
+func Middleware(cfg nethttp.Config) mux.MiddlewareFunc {
+	return nethttp.Middleware(cfg)
+}
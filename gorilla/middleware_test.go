@@ -0,0 +1,20 @@
+package gorilla
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/theovassiliou/instanceidentification/internal/middlewaretest"
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+func TestMiddleware(t *testing.T) {
+	middlewaretest.Run(t, func(cfg nethttp.Config, h http.HandlerFunc) http.Handler {
+		r := mux.NewRouter()
+		r.Use(Middleware(cfg))
+		r.HandleFunc("/health", h).Methods(http.MethodGet)
+		return r
+	})
+}
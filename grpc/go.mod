@@ -0,0 +1,20 @@
+module github.com/theovassiliou/instanceidentification/grpc
+
+go 1.17
+
+require (
+	github.com/theovassiliou/instanceidentification v0.0.0-20261017042535-5060ee9f6eb1
+	google.golang.org/grpc v1.56.3
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/theovassiliou/base64url v0.0.0-20211006203958-1e011490eaaf // indirect
+	github.com/xlab/treeprint v1.1.0 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
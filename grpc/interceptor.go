@@ -0,0 +1,200 @@
+// Package grpc makes gRPC services IID aware. The server interceptors answer
+// iid-requests sent in x-instance-id metadata like nethttp.Middleware does for
+// HTTP, the client interceptors send iid-requests and record the Ciids of the
+// called services like nethttp.Transport does.
+package grpc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	iid "github.com/theovassiliou/instanceidentification"
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+// MetadataKey is the metadata key of iid-requests and Ciids
+var MetadataKey = strings.ToLower(iid.XINSTANCEID)
+
+// UnaryServerInterceptor returns an interceptor answering iid-requests, see
+// nethttp.Middleware. The Ciid is sent in header metadata, or in trailer
+// metadata if the handler has already sent the header.
+func UnaryServerInterceptor(cfg nethttp.Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, e := cfg.Begin(ctx, incoming(ctx))
+		if e == nil {
+			return handler(ctx, req)
+		}
+
+		resp, err := handler(ctx, req)
+		md := response(e)
+		if grpc.SetHeader(ctx, md) != nil {
+			grpc.SetTrailer(ctx, md)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor answering iid-requests, see
+// nethttp.Middleware. The Ciid is sent in trailer metadata, so that it
+// includes the calls recorded while streaming.
+func StreamServerInterceptor(cfg nethttp.Config) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, e := cfg.Begin(ss.Context(), incoming(ss.Context()))
+		if e == nil {
+			return handler(srv, ss)
+		}
+
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		ss.SetTrailer(response(e))
+		return err
+	}
+}
+
+// serverStream carries the Recorder in its context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// incoming returns the iid-request in the incoming metadata of ctx
+func incoming(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(MetadataKey); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// response returns the metadata answering the iid-request of e
+func response(e *nethttp.Exchange) metadata.MD {
+	h := http.Header{}
+	e.SetHeader(h)
+	md := metadata.MD{}
+	for k, v := range h {
+		md.Set(k, v...)
+	}
+	return md
+}
+
+// Client sends iid-requests with the calls made with a context carrying a
+// Recorder, see iid.RecorderFrom, and records the Ciids of the called
+// services, see nethttp.Transport. Calls without Recorder are made
+// unchanged.
+type Client struct {
+	nethttp.ClientConfig
+
+	// Expectation returns the Miid recorded by expectation for a call of
+	// method on target. If nil ExpectedMiid is used.
+	Expectation func(target, method string) iid.Miid
+}
+
+// ExpectedMiid returns the Miid of an external service named after the gRPC
+// service of method, e.g. pkg.Service for /pkg.Service/Method, see
+// iid.NewExternalMiid
+func ExpectedMiid(target, method string) iid.Miid {
+	service := strings.TrimPrefix(method, "/")
+	if i := strings.LastIndex(service, "/"); i >= 0 {
+		service = service[:i]
+	}
+	return iid.NewExternalMiid(service, target+method)
+}
+
+// UnaryClientInterceptor returns an interceptor recording the called services
+func (c *Client) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		rec := iid.RecorderFrom(ctx)
+		if rec == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, expected := c.start(ctx, rec, cc.Target(), method)
+		var header, trailer metadata.MD
+		opts = append(opts, grpc.Header(&header), grpc.Trailer(&trailer))
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		c.record(rec, expected, method, header, trailer)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor recording the called
+// services. The Ciid is recorded when the stream ends.
+func (c *Client) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		rec := iid.RecorderFrom(ctx)
+		if rec == nil {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		ctx, expected := c.start(ctx, rec, cc.Target(), method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return cs, err
+		}
+		return &clientStream{ClientStream: cs, client: c, desc: desc, method: method, rec: rec, expected: expected}, nil
+	}
+}
+
+// start adds the iid-request to the outgoing metadata of ctx and records
+// the call by expectation if rec does
+func (c *Client) start(ctx context.Context, rec *iid.Recorder, target, method string) (context.Context, int) {
+	ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, c.RequestString())
+
+	expected := -1
+	if rec.Mode() == iid.ByExpectation {
+		expectation := c.Expectation
+		if expectation == nil {
+			expectation = ExpectedMiid
+		}
+		var err error
+		if expected, err = rec.Expect(expectation(target, method)); err != nil {
+			c.Logf("grpc: expecting %v: %v", method, err)
+		}
+	}
+	return ctx, expected
+}
+
+// record records the Ciid sent in header or trailer metadata in response
+// to a call of method
+func (c *Client) record(rec *iid.Recorder, expected int, method string, header, trailer metadata.MD) {
+	md := header
+	if len(md.Get(MetadataKey)) == 0 {
+		md = trailer
+	}
+	h := http.Header{}
+	for k, v := range md {
+		h[http.CanonicalHeaderKey(k)] = v
+	}
+	if err := nethttp.RecordResponse(rec, expected, c.SealKey, h); err != nil {
+		c.Logf("grpc: recording %v: %v", method, err)
+	}
+}
+
+// clientStream records the Ciid of the called service when the stream ends
+type clientStream struct {
+	grpc.ClientStream
+	client   *Client
+	desc     *grpc.StreamDesc
+	method   string
+	rec      *iid.Recorder
+	expected int
+	done     bool
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	// a stream without server streaming ends with its only response
+	if !s.done && (err != nil || !s.desc.ServerStreams) {
+		s.done = true
+		header, _ := s.ClientStream.Header()
+		s.client.record(s.rec, s.expected, s.method, header, s.ClientStream.Trailer())
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	iid "github.com/theovassiliou/instanceidentification"
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+// healthServer records a call to the database in every call
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	iid.RecorderFrom(ctx).Record(iid.NewStdCiid("database/1.2%33s"))
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if err := stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}); err != nil {
+		return err
+	}
+	// calls recorded after the first message are sent in the trailer
+	iid.RecorderFrom(stream.Context()).Record(iid.NewStdCiid("database/1.2%33s"))
+	return nil
+}
+
+// dial returns a client of an in-process health server using the server
+// interceptors with cfg, or none if cfg is nil
+func dial(t *testing.T, cfg *nethttp.Config, client *Client) healthpb.HealthClient {
+	lis := bufconn.Listen(1 << 20)
+	var opts []grpc.ServerOption
+	if cfg != nil {
+		cfg.Miid = iid.NewStdMiid("ourService/1.1%-1s")
+		cfg.StartTime = time.Now()
+		opts = append(opts,
+			grpc.UnaryInterceptor(UnaryServerInterceptor(*cfg)),
+			grpc.StreamInterceptor(StreamServerInterceptor(*cfg)))
+	}
+	s := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(s, healthServer{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(client.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(client.StreamClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+// check calls Check and Watch of c with a Recorder and returns the Ciid
+// recorded
+func check(t *testing.T, c healthpb.HealthClient, mode iid.RecordingMode) string {
+	rec := iid.NewRecorder(iid.NewStdMiid("gw/1%-1s"), time.Now()).SetMode(mode)
+	ctx := iid.WithRecorder(context.Background(), rec)
+	if _, err := c.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	stream, err := c.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+	}
+	return rec.Ciid().String()
+}
+
+func TestInterceptors(t *testing.T) {
+	const callee = "ourService/1.1%0s(database/1.2%33s)"
+	expected := iid.ExpectedMarker + ExpectedMiid("bufnet", "/grpc.health.v1.Health/Check").String() + "+" +
+		iid.ExpectedMarker + ExpectedMiid("bufnet", "/grpc.health.v1.Health/Watch").String()
+	tests := []struct {
+		name   string
+		cfg    *nethttp.Config
+		client Client
+		mode   iid.RecordingMode
+		want   string
+	}{
+		{"recorded", &nethttp.Config{}, Client{}, iid.ByConfirmation, "gw/1%0s(" + callee + "+" + callee + ")"},
+		{"key", &nethttp.Config{Authorizer: iid.StaticKeys{"abc": {}}}, Client{ClientConfig: nethttp.ClientConfig{Request: iid.NewIRequestFromString("key=abc")}}, iid.ByConfirmation, "gw/1%0s(" + callee + "+" + callee + ")"},
+		{"wrong key", &nethttp.Config{Authorizer: iid.StaticKeys{"abc": {}}}, Client{ClientConfig: nethttp.ClientConfig{Request: iid.NewIRequestFromString("key=abd")}}, iid.ByConfirmation, "gw/1%0s"},
+		{"shallow", &nethttp.Config{}, Client{ClientConfig: nethttp.ClientConfig{Request: iid.NewIRequestFromString("empty options=s")}}, iid.ByConfirmation, "gw/1%0s(ourService/1.1%0s+ourService/1.1%0s)"},
+		{"unaware callee", nil, Client{}, iid.ByConfirmation, "gw/1%0s"},
+		{"expected", &nethttp.Config{}, Client{}, iid.ByExpectation, "gw/1%0s(" + callee + "+" + callee + ")"},
+		{"expected unaware callee", nil, Client{}, iid.ByExpectation, "gw/1%0s(" + expected + ")"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, tt.cfg, &tt.client)
+			if got := check(t, c, tt.mode); got != tt.want {
+				t.Errorf("Ciid = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterceptors_sealed(t *testing.T) {
+	sealKey := []byte("0123456789abcdef")
+	c := dial(t,
+		&nethttp.Config{Seal: true, Authorizer: iid.StaticKeys{"caffee": {Scope: iid.Deep, SealKey: sealKey}}},
+		&Client{ClientConfig: nethttp.ClientConfig{Request: iid.NewIRequestFromString("key=caffee"), SealKey: sealKey}})
+	if got, want := check(t, c, iid.ByConfirmation), "gw/1%0s(ourService/1.1%0s(database/1.2%33s)+ourService/1.1%0s(database/1.2%33s))"; got != want {
+		t.Errorf("Ciid = %v, want %v", got, want)
+	}
+}
+
+func TestInterceptors_noRecorder(t *testing.T) {
+	var got *iid.Recorder
+	lis := bufconn.Listen(1 << 20)
+	cfg := nethttp.Config{Miid: iid.NewStdMiid("ourService/1.1%-1s"), StartTime: time.Now()}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return UnaryServerInterceptor(cfg)(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			got = iid.RecorderFrom(ctx)
+			return handler(ctx, req)
+		})
+	}))
+	healthpb.RegisterHealthServer(s, healthServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor((&Client{}).UnaryClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if got != nil {
+		t.Errorf("RecorderFrom() = %v, want nil without iid-request", got)
+	}
+}
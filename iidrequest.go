@@ -19,12 +19,25 @@ func (o IOption) Command() string {
 	return o.commandName
 }
 
-// NewIRequestFromString creates a new IRequest from a value header passed as string
+// NewIRequestFromString creates a new IRequest from a value header passed as string.
+// Elements that can not be interpreted are ignored, use ParseIRequest to detect them.
 func NewIRequestFromString(v string) *IRequest {
+	r, _ := ParseIRequest(v)
+	return r
+}
+
+// ParseIRequest creates a new IRequest like NewIRequestFromString, but
+// reports the first element that can not be interpreted as *ParseError.
+// In case of an error the returned IRequest is identical to the one
+// NewIRequestFromString returns.
+func ParseIRequest(v string) (*IRequest, error) {
 	r := &IRequest{
 		key: "empty",
 	}
-	return r.parseIidRequest(v)
+	if err := r.parse(v); err != nil {
+		return r, err
+	}
+	return r, nil
 }
 
 // SetIidAuth set's the authorisation key value. Chainable
@@ -108,52 +121,92 @@ func (r IRequest) GetHeader() string {
 
 // parseIidRequest fills r based on given Iid header value
 func (r *IRequest) parseIidRequest(id string) *IRequest {
+	r.parse(id)
+	return r
+}
+
+// parse fills r based on given Iid header value. Elements that can not be
+// interpreted are skipped, the first of them is returned as *ParseError.
+func (r *IRequest) parse(id string) (err *ParseError) {
 	r.key = "empty"
 	r.options = Options{}
 
-	lastQuote := rune(0)
-	f := func(c rune) bool {
-		switch {
-		case c == lastQuote:
-			lastQuote = rune(0)
-			return false
-		case lastQuote != rune(0):
-			return false
-		case unicode.In(c, unicode.Quotation_Mark):
-			lastQuote = c
-			return false
-		default:
-			return unicode.IsSpace(c)
-
+	fail := func(kind ErrorKind, offset int, token string) {
+		if err == nil {
+			err = &ParseError{
+				Input:     id,
+				Violation: Violation{Offset: offset, Token: token, Kind: kind},
+			}
 		}
 	}
 
-	// splitting string by space but considering quoted section
-	items := strings.FieldsFunc(id, f)
+	fields := requestFields(id)
+	if len(fields) == 0 {
+		fail(KindEmpty, 0, id)
+	}
 
-	// create and fill the map
-	m := make(map[string]string)
-	for _, item := range items {
+	for _, f := range fields {
+		item := id[f[0]:f[1]]
 		x := strings.Split(item, "=")
+		k, v := x[0], ""
 		if len(x) == 2 {
-			m[x[0]] = x[1]
-		} else {
-			m[x[0]] = ""
+			v = x[1]
 		}
-	}
 
-	// determine key
-	for k, v := range m {
-		if k == "empty" {
+		switch k {
+		case "empty":
 			r.SetIidAuth("empty")
-		} else if k == "key" {
+		case "key":
 			r.SetIidAuth(v)
-		} else if k == "options" {
+			if v == "" {
+				fail(KindEmptyKey, f[0], item)
+			}
+		case "options":
 			r.options = parseOption(v)
+			for i, char := range v {
+				if !unicode.IsLetter(char) {
+					fail(KindInvalidOption, f[0]+len(k)+1+i, string(char))
+				}
+			}
+		default:
+			// "empty;" is tolerated as empty key
+			if strings.TrimSuffix(k, ";") != "empty" {
+				fail(KindUnknownElement, f[0], item)
+			}
 		}
 	}
 
-	return r
+	return err
+}
+
+// requestFields splits v by white space, but keeps quoted sections together.
+// It returns the start and end byte offset of every field.
+func requestFields(v string) (fields [][2]int) {
+	lastQuote := rune(0)
+	start := -1
+	for pos, c := range v {
+		var sep bool
+		switch {
+		case c == lastQuote:
+			lastQuote = rune(0)
+		case lastQuote != rune(0):
+		case unicode.In(c, unicode.Quotation_Mark):
+			lastQuote = c
+		default:
+			sep = unicode.IsSpace(c)
+		}
+
+		if sep && start >= 0 {
+			fields = append(fields, [2]int{start, pos})
+			start = -1
+		} else if !sep && start < 0 {
+			start = pos
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, [2]int{start, len(v)})
+	}
+	return fields
 }
 
 // parseIidRequest fills r based on given Iid header value
@@ -968,7 +968,7 @@ func TestIRequest_HasKey(t *testing.T) {
 	}
 }
 
-func ExampleNewIRequestFromString_Simplest() {
+func ExampleNewIRequestFromString_simplest() {
 	// Create a new Request object with no auth key and some options
 	iir := NewIRequestFromString("")
 
@@ -995,7 +995,7 @@ func ExampleNewIRequestFromString() {
 	// Header: X-Instance-Id: empty options=cv
 }
 
-func ExampleNewIRequestFromString_WithKey() {
+func ExampleNewIRequestFromString_withKey() {
 	iir := NewIRequestFromString("key=caffee")
 	fmt.Println("String: " + iir.String())
 	fmt.Println("IdAuth: " + iir.GetIidAuth())
@@ -0,0 +1,284 @@
+package instanceid
+
+import "time"
+
+// ImmutableMiid is a Miid that never changes once created. SetT and SetEpoch
+// return modified copies and leave the receiver untouched, as do the With
+// methods. The zero value is an empty Miid.
+type ImmutableMiid struct {
+	m StdMiid
+}
+
+// FreezeMiid returns an ImmutableMiid with the fields of m
+func FreezeMiid(m Miid) ImmutableMiid {
+	if im, ok := m.(ImmutableMiid); ok {
+		return im
+	}
+	return ImmutableMiid{StdMiid{sn: m.Sn(), vn: m.Vn(), va: m.Va(), t: m.T()}}
+}
+
+func (m ImmutableMiid) Sn() string {
+	return m.m.sn
+}
+
+func (m ImmutableMiid) Vn() string {
+	return m.m.vn
+}
+
+func (m ImmutableMiid) Va() string {
+	return m.m.va
+}
+
+func (m ImmutableMiid) T() int {
+	return m.m.t
+}
+
+// String returns the textual representation of the Miid, see StdMiid.String
+func (m ImmutableMiid) String() string {
+	return m.m.String()
+}
+
+// WithSn returns a copy of m with the service name sn
+func (m ImmutableMiid) WithSn(sn string) ImmutableMiid {
+	m.m.sn = sn
+	return m
+}
+
+// WithVn returns a copy of m with the version number vn
+func (m ImmutableMiid) WithVn(vn string) ImmutableMiid {
+	m.m.vn = vn
+	return m
+}
+
+// WithVa returns a copy of m with the application specific part va
+func (m ImmutableMiid) WithVa(va string) ImmutableMiid {
+	m.m.va = va
+	return m
+}
+
+// WithT returns a copy of m with the epoch t in s
+func (m ImmutableMiid) WithT(t int) ImmutableMiid {
+	m.m.t = t
+	return m
+}
+
+// WithEpoch returns a copy of m with the epoch set to now, with time being
+// startTime of service
+func (m ImmutableMiid) WithEpoch(startTime time.Time) ImmutableMiid {
+	m.m.SetEpoch(startTime)
+	return m
+}
+
+// SetT returns a copy of m with the epoch t in s, see WithT
+func (m ImmutableMiid) SetT(t int) Miid {
+	return m.WithT(t)
+}
+
+// SetEpoch returns a copy of m with the epoch set to now, see WithEpoch
+func (m ImmutableMiid) SetEpoch(startTime time.Time) Miid {
+	return m.WithEpoch(startTime)
+}
+
+// ImmutableCiid is a Ciid that never changes once created, so that it can be
+// shared safely across goroutines, e.g. as template of the service's own
+// identity. SetEpoch and SetCiids return modified copies and leave the
+// receiver untouched, as do the With methods. Copies share the calls that
+// have not changed. The zero value is an empty Ciid.
+type ImmutableCiid struct {
+	miid      ImmutableMiid
+	expected  bool
+	semantics CallSemantics
+
+	// calls is shared by copies, a pointer keeps ImmutableCiid comparable
+	calls *Stack
+}
+
+// Freeze returns an ImmutableCiid with the call graph of c. Calls that are
+// ImmutableCiids already are shared, not copied.
+func Freeze(c Ciid) ImmutableCiid {
+	if ic, ok := c.(ImmutableCiid); ok {
+		return ic
+	}
+	ic := ImmutableCiid{miid: FreezeMiid(c.Miid()), expected: IsExpected(c), semantics: SemanticsOf(c)}
+	ic.calls = freezeCalls(c.Ciids())
+	return ic
+}
+
+// freezeCalls returns the frozen calls in a new Stack without spare
+// capacity, so that appending to it never changes a shared Stack
+func freezeCalls(calls Stack) *Stack {
+	if len(calls) == 0 {
+		return nil
+	}
+	frozen := make(Stack, len(calls))
+	for i, call := range calls {
+		frozen[i] = Freeze(call)
+	}
+	return &frozen
+}
+
+func (c ImmutableCiid) stack() Stack {
+	if c.calls == nil {
+		return nil
+	}
+	return *c.calls
+}
+
+// Miid returns the Miid of the Ciid, an ImmutableMiid
+func (c ImmutableCiid) Miid() Miid {
+	return c.miid
+}
+
+// Ciids returns a copy of the calls, all of them ImmutableCiids
+func (c ImmutableCiid) Ciids() Stack {
+	if c.calls == nil {
+		return nil
+	}
+	return append(Stack(nil), *c.calls...)
+}
+
+// Expected returns true if the Ciid has been recorded by expectation, see
+// IsExpected
+func (c ImmutableCiid) Expected() bool {
+	return c.expected
+}
+
+// Semantics returns the call semantics of the call graph, see Canonical
+func (c ImmutableCiid) Semantics() CallSemantics {
+	return c.semantics
+}
+
+// String returns the textual representation of the Ciid, see StdCiid.String
+func (c ImmutableCiid) String() string {
+	return StdCiid{miid: &c.miid.m, ciids: c.stack(), expected: c.expected, semantics: c.semantics}.String()
+}
+
+// WithMiid returns a copy of c identified by m
+func (c ImmutableCiid) WithMiid(m Miid) ImmutableCiid {
+	c.miid = FreezeMiid(m)
+	return c
+}
+
+// WithExpected returns a copy of c marked as recorded by expectation, or by
+// confirmation if expected is false
+func (c ImmutableCiid) WithExpected(expected bool) ImmutableCiid {
+	c.expected = expected
+	return c
+}
+
+// WithEpoch returns a copy of c with the epoch set to now, with time being
+// startTime of service
+func (c ImmutableCiid) WithEpoch(startTime time.Time) ImmutableCiid {
+	c.miid = c.miid.WithEpoch(startTime)
+	return c
+}
+
+// WithCalls returns a copy of c with the given calls replacing its calls
+func (c ImmutableCiid) WithCalls(calls ...Ciid) ImmutableCiid {
+	c.calls = freezeCalls(calls)
+	return c
+}
+
+// WithCall returns a copy of c with call added to its calls
+func (c ImmutableCiid) WithCall(call Ciid) ImmutableCiid {
+	calls := make(Stack, len(c.stack()), len(c.stack())+1)
+	copy(calls, c.stack())
+	calls = append(calls, Freeze(call))
+	c.calls = &calls
+	return c
+}
+
+// SetEpoch returns a copy of c with the epoch set to now, see WithEpoch
+func (c ImmutableCiid) SetEpoch(startTime time.Time) Ciid {
+	return c.WithEpoch(startTime)
+}
+
+// SetCiids returns a copy of c with the calls s, see WithCalls
+func (c ImmutableCiid) SetCiids(s Stack) Ciid {
+	return c.WithCalls(s...)
+}
+
+// MiidBuilder constructs an ImmutableMiid field by field
+type MiidBuilder struct {
+	m ImmutableMiid
+}
+
+// NewMiidBuilder returns a MiidBuilder for the service sn in version vn
+func NewMiidBuilder(sn, vn string) *MiidBuilder {
+	return &MiidBuilder{ImmutableMiid{StdMiid{sn: sn, vn: vn}}}
+}
+
+// Va sets the application specific part. Chainable
+func (b *MiidBuilder) Va(va string) *MiidBuilder {
+	b.m = b.m.WithVa(va)
+	return b
+}
+
+// T sets the epoch in s. Chainable
+func (b *MiidBuilder) T(t int) *MiidBuilder {
+	b.m = b.m.WithT(t)
+	return b
+}
+
+// Epoch sets the epoch to now, with time being startTime of service. Chainable
+func (b *MiidBuilder) Epoch(startTime time.Time) *MiidBuilder {
+	b.m = b.m.WithEpoch(startTime)
+	return b
+}
+
+// Build returns the ImmutableMiid. The builder may be reused.
+func (b *MiidBuilder) Build() ImmutableMiid {
+	return b.m
+}
+
+// CiidBuilder constructs an ImmutableCiid call by call
+type CiidBuilder struct {
+	miid      ImmutableMiid
+	expected  bool
+	semantics CallSemantics
+	calls     Stack
+}
+
+// NewCiidBuilder returns a CiidBuilder for the service identified by m
+func NewCiidBuilder(m Miid) *CiidBuilder {
+	return &CiidBuilder{miid: FreezeMiid(m)}
+}
+
+// NewCiidBuilderFrom returns a CiidBuilder starting with the Miid, calls,
+// expected mark and call semantics of c
+func NewCiidBuilderFrom(c Ciid) *CiidBuilder {
+	b := &CiidBuilder{miid: FreezeMiid(c.Miid()), expected: IsExpected(c), semantics: SemanticsOf(c)}
+	return b.Call(c.Ciids()...)
+}
+
+// Expected marks the Ciid as recorded by expectation, see IsExpected. Chainable
+func (b *CiidBuilder) Expected(expected bool) *CiidBuilder {
+	b.expected = expected
+	return b
+}
+
+// Semantics sets the call semantics, see Canonical. Chainable
+func (b *CiidBuilder) Semantics(s CallSemantics) *CiidBuilder {
+	b.semantics = s
+	return b
+}
+
+// Epoch sets the epoch to now, with time being startTime of service. Chainable
+func (b *CiidBuilder) Epoch(startTime time.Time) *CiidBuilder {
+	b.miid = b.miid.WithEpoch(startTime)
+	return b
+}
+
+// Call adds the given calls. Chainable
+func (b *CiidBuilder) Call(calls ...Ciid) *CiidBuilder {
+	for _, call := range calls {
+		b.calls = append(b.calls, Freeze(call))
+	}
+	return b
+}
+
+// Build returns the ImmutableCiid. The builder may be reused, later calls
+// do not change Ciids built before.
+func (b *CiidBuilder) Build() ImmutableCiid {
+	return ImmutableCiid{miid: b.miid, expected: b.expected, semantics: b.semantics, calls: freezeCalls(b.calls)}
+}
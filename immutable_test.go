@@ -0,0 +1,147 @@
+package instanceid
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFreeze(t *testing.T) {
+	id := "msA/1.1/dev%22s(msB/2.2%33s(msC/1%1s)+msD/a%2Bb%4s)"
+	std := NewStdCiid(id)
+	c := Freeze(std)
+	if got := c.String(); got != id {
+		t.Errorf("Freeze() = %v, want %v", got, id)
+	}
+	if !Equal(c, std) {
+		t.Errorf("Equal(Freeze(c), c) = false, want true")
+	}
+
+	std.Ciids()[0].SetEpoch(time.Now())
+	std.SetCiids(nil)
+	if got := c.String(); got != id {
+		t.Errorf("Freeze() = %v after modifying the original, want %v", got, id)
+	}
+	if f := Freeze(c); f.stack()[0].(ImmutableCiid).calls != c.stack()[0].(ImmutableCiid).calls {
+		t.Errorf("Freeze() copied an ImmutableCiid, want shared")
+	}
+}
+
+func TestImmutableCiid_With(t *testing.T) {
+	template := NewCiidBuilder(NewMiidBuilder("ourService", "1.1").T(-1).Build()).Build()
+	db := Freeze(NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+
+	tests := []struct {
+		name string
+		got  Ciid
+		want string
+	}{
+		{"template", template, "ourService/1.1%-1s"},
+		{"WithCall", template.WithCall(db), "ourService/1.1%-1s(database/1.2%33s(storageService/0.2%77s))"},
+		{"WithCall twice", template.WithCall(db).WithCall(leaf("mon/1%2s")), "ourService/1.1%-1s(database/1.2%33s(storageService/0.2%77s)+mon/1%2s)"},
+		{"WithCalls", template.WithCall(db).WithCalls(), "ourService/1.1%-1s"},
+		{"WithMiid", template.WithMiid(template.miid.WithVa("dev").WithT(5)), "ourService/1.1/dev%5s"},
+		{"WithEpoch", template.WithEpoch(time.Now().Add(-3 * time.Second)), "ourService/1.1%3s"},
+		{"SetCiids", template.SetCiids(Stack{db}), "ourService/1.1%-1s(database/1.2%33s(storageService/0.2%77s))"},
+		{"SetEpoch", template.SetEpoch(time.Now()), "ourService/1.1%0s"},
+		{"Miid SetT", template.WithMiid(template.Miid().SetT(7)), "ourService/1.1%7s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got.String(); got != tt.want {
+				t.Errorf("%v = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+	if got := template.String(); got != "ourService/1.1%-1s" {
+		t.Errorf("template = %v, want unmodified", got)
+	}
+}
+
+// leaf returns a Ciid without calls
+func leaf(miid string) Ciid {
+	return &StdCiid{miid: NewStdMiid(miid)}
+}
+
+func TestImmutableCiid_sharedStack(t *testing.T) {
+	a := ImmutableCiid{}.WithCall(leaf("a/1%1s"))
+	b := a.WithCall(leaf("b/1%1s"))
+	c := a.WithCall(leaf("c/1%1s"))
+
+	calls := b.Ciids()
+	calls.Push(leaf("d/1%1s"))
+	calls[0] = leaf("e/1%1s")
+
+	if got, want := b.String()+" "+c.String(), "(a/1%1s+b/1%1s) (a/1%1s+c/1%1s)"; got != want {
+		t.Errorf("WithCall() = %v, want %v", got, want)
+	}
+	if b.stack()[0] != c.stack()[0] {
+		t.Errorf("WithCall() copied the unchanged call, want shared")
+	}
+}
+
+func TestImmutableCiid_concurrent(t *testing.T) {
+	template := Freeze(NewStdCiid("ourService/1.1%-1s"))
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := template.WithCall(leaf("db/1%1s")).SetEpoch(start)
+			if got := c.String(); got != "ourService/1.1%0s(db/1%1s)" {
+				t.Errorf("String() = %v", got)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCiidBuilder(t *testing.T) {
+	b := NewCiidBuilder(NewStdMiid("gw/1.1%1s")).
+		Call(NewCiidBuilder(NewMiidBuilder("db", "1.2").Va("eu/west").T(2).Build()).
+			Call(NewStdCiid("storage/0.2%3s")).
+			Build())
+	first := b.Build()
+	second := b.Call(NewStdCiid("mon/1.1%4s")).Build()
+
+	if got, want := first.String(), "gw/1.1%1s(db/1.2/eu/west%2s(storage/0.2%3s))"; got != want {
+		t.Errorf("Build() = %v, want %v", got, want)
+	}
+	if got, want := second.String(), "gw/1.1%1s(db/1.2/eu/west%2s(storage/0.2%3s)+mon/1.1%4s)"; got != want {
+		t.Errorf("Build() = %v, want %v", got, want)
+	}
+}
+
+func TestCiidBuilder_marks(t *testing.T) {
+	src := NewCiidBuilder(NewStdMiid("gw/1.1%1s")).
+		Expected(true).
+		Semantics(Contacted).
+		Call(NewStdCiid("db/1.2%2s")).
+		Build()
+	if !src.Expected() || src.Semantics() != Contacted {
+		t.Errorf("Build() = %v, want expected with contacted semantics", src)
+	}
+
+	c := NewCiidBuilderFrom(src).Call(NewStdCiid("mon/1.1%4s")).Build()
+	if !IsExpected(c) || SemanticsOf(c) != Contacted {
+		t.Errorf("NewCiidBuilderFrom().Build() = %v, want the marks of the source", c)
+	}
+	if got, want := c.String(), "+?gw/1.1%1s(db/1.2%2s+mon/1.1%4s)"; got != want {
+		t.Errorf("NewCiidBuilderFrom().Build() = %v, want %v", got, want)
+	}
+	if got := len(src.Ciids()); got != 1 {
+		t.Errorf("source has %v calls after building from it, want 1", got)
+	}
+}
+
+func TestStdCiid_SetStack(t *testing.T) {
+	c := NewStdCiid("a/1%1s")
+	c.SetStack(Stack{NewStdCiid("b/1%1s")})
+	if got, want := c.String(), "a/1%1s(b/1%1s)"; got != want {
+		t.Errorf("SetStack() = %v, want %v", got, want)
+	}
+	if got, want := c.ClearStack().String(), "a/1%1s"; got != want {
+		t.Errorf("ClearStack() = %v, want %v", got, want)
+	}
+}
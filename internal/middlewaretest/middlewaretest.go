@@ -0,0 +1,122 @@
+// Package middlewaretest is the test suite shared by the adapters of
+// nethttp.Middleware to routers.
+package middlewaretest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	iid "github.com/theovassiliou/instanceidentification"
+	"github.com/theovassiliou/instanceidentification/nethttp"
+)
+
+// Router returns a router serving h on GET /health through the middleware
+// of the adapter under test, configured with cfg
+type Router func(cfg nethttp.Config, h http.HandlerFunc) http.Handler
+
+// serve serves GET /health with the iid-request value through router
+func serve(router Router, cfg nethttp.Config, request string, h http.HandlerFunc) *httptest.ResponseRecorder {
+	if cfg.Miid == nil {
+		cfg.Miid = iid.NewStdMiid("ourService/1.1%-1s")
+		cfg.StartTime = time.Now()
+	}
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	if request != "" {
+		req.Header.Set(iid.XINSTANCEID, request)
+	}
+	w := httptest.NewRecorder()
+	router(cfg, h).ServeHTTP(w, req)
+	return w
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	rec := iid.RecorderFrom(r.Context())
+	rec.Record(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+	rec.Record(iid.NewStdCiid("monitoring/1.1%22242s"))
+	w.WriteHeader(http.StatusAccepted)
+	// calls recorded after the header has been written are lost
+	rec.Record(iid.NewStdCiid("late/1%1s"))
+	w.Write([]byte("ok"))
+}
+
+// Run runs the test suite against the adapter returning router
+func Run(t *testing.T, router Router) {
+	t.Run("requests", func(t *testing.T) { testRequests(t, router) })
+	t.Run("no write", func(t *testing.T) { testNoWrite(t, router) })
+	t.Run("per request", func(t *testing.T) { testPerRequest(t, router) })
+	t.Run("sealed", func(t *testing.T) { testSealed(t, router) })
+}
+
+func testRequests(t *testing.T, router Router) {
+	const deep = "ourService/1.1%0s(database/1.2%33s(storageService/0.2%77s)+monitoring/1.1%22242s)"
+	tests := []struct {
+		name    string
+		cfg     nethttp.Config
+		request string
+		want    string
+	}{
+		{"not requested", nethttp.Config{}, "", ""},
+		{"empty", nethttp.Config{}, "empty", deep},
+		{"key", nethttp.Config{Authorizer: iid.StaticKeys{"abc": {}}}, "key=abc", deep},
+		{"wrong key", nethttp.Config{Authorizer: iid.StaticKeys{"abc": {}}}, "key=abd", ""},
+		{"shallow key", nethttp.Config{Authorizer: iid.StaticKeys{"abc": {Scope: iid.Shallow}}}, "key=abc options=d", "ourService/1.1%0s"},
+		{"shallow", nethttp.Config{}, "empty options=s", "ourService/1.1%0s"},
+		{"truncated", nethttp.Config{Policy: iid.DisclosurePolicy{MaxDepth: 2}}, "empty", "ourService/1.1%0s(database/1.2%33s+monitoring/1.1%22242s)"},
+		{"contacted", nethttp.Config{}, "empty options=c", "+" + deep},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.cfg, tt.request, health)
+			if got := w.Header().Get(iid.XINSTANCEID); got != tt.want {
+				t.Errorf("X-Instance-Id = %v, want %v", got, tt.want)
+			}
+			if w.Code != http.StatusAccepted || w.Body.String() != "ok" {
+				t.Errorf("response = %v %v, want %v ok", w.Code, w.Body, http.StatusAccepted)
+			}
+		})
+	}
+}
+
+func testNoWrite(t *testing.T, router Router) {
+	w := serve(router, nethttp.Config{}, "empty", func(w http.ResponseWriter, r *http.Request) {
+		iid.RecorderFrom(r.Context()).Record(iid.NewStdCiid("db/1%1s"))
+	})
+	if got, want := w.Header().Get(iid.XINSTANCEID), "ourService/1.1%0s(db/1%1s)"; got != want {
+		t.Errorf("X-Instance-Id = %v, want %v", got, want)
+	}
+}
+
+// testPerRequest checks that the calls of one request do not leak into the
+// Ciid of another one served by the same router
+func testPerRequest(t *testing.T, router Router) {
+	cfg := nethttp.Config{Miid: iid.NewStdMiid("ourService/1.1%-1s"), StartTime: time.Now()}
+	n := 0
+	h := router(cfg, func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n == 1 {
+			iid.RecorderFrom(r.Context()).Record(iid.NewStdCiid("db/1%1s"))
+		}
+	})
+	want := []string{"ourService/1.1%0s(db/1%1s)", "ourService/1.1%0s"}
+	for i := range want {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set(iid.XINSTANCEID, "empty")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := w.Header().Get(iid.XINSTANCEID); got != want[i] {
+			t.Errorf("request %v: X-Instance-Id = %v, want %v", i+1, got, want[i])
+		}
+	}
+}
+
+func testSealed(t *testing.T, router Router) {
+	sealKey := []byte("0123456789abcdef")
+	cfg := nethttp.Config{Seal: true, Authorizer: iid.StaticKeys{"caffee": {Scope: iid.Deep, SealKey: sealKey}}}
+	w := serve(router, cfg, "key=caffee", health)
+	c, err := iid.Open(w.Header().Get(iid.XINSTANCEID), sealKey)
+	if err != nil || len(c.Ciids()) != 2 {
+		t.Errorf("Open() = %v, %v, want ourService with 2 calls", c, err)
+	}
+}
@@ -0,0 +1,204 @@
+package instanceid
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// jsonCiid is the JSON representation of a Ciid, e.g.
+//
+//	{"sn":"msA","vn":"1.1","va":"dev","t":22,"calls":[{"sn":"msB","vn":"2.2","t":33}]}
+//
+// va and calls are omitted if empty, expected is only present for Ciids
+// recorded by expectation, semantics only for the outermost Ciid of a call
+// graph with Contacted semantics and for calls whose semantics differ from
+// the calling Ciid's, see ContactedMarker. A Miid is represented the same way
+// without calls.
+type jsonCiid struct {
+	Sn        string      `json:"sn"`
+	Vn        string      `json:"vn"`
+	Va        string      `json:"va,omitempty"`
+	T         int         `json:"t"`
+	Expected  bool        `json:"expected,omitempty"`
+	Semantics string      `json:"semantics,omitempty"`
+	Calls     []*jsonCiid `json:"calls,omitempty"`
+}
+
+// newJSONGraph returns the JSON representation of the call graph of c
+func newJSONGraph(c Ciid) *jsonCiid {
+	j := newJSONCiid(c)
+	if s := SemanticsOf(c); s != Called {
+		j.Semantics = s.String()
+	}
+	return j
+}
+
+func newJSONCiid(c Ciid) *jsonCiid {
+	j := new(jsonCiid)
+	if m := c.Miid(); m != nil {
+		j.Sn, j.Vn, j.Va, j.T = m.Sn(), m.Vn(), m.Va(), m.T()
+	}
+	j.Expected = IsExpected(c)
+	s := SemanticsOf(c)
+	for _, call := range c.Ciids() {
+		jc := newJSONCiid(call)
+		if ownSemantics(s, call) {
+			jc.Semantics = SemanticsOf(call).String()
+		}
+		j.Calls = append(j.Calls, jc)
+	}
+	return j
+}
+
+func (j *jsonCiid) stdMiid() *StdMiid {
+	return &StdMiid{sn: j.Sn, vn: j.Vn, va: j.Va, t: j.T}
+}
+
+// stdCiid returns the Ciid represented by j, with the semantics s unless j
+// carries its own
+func (j *jsonCiid) stdCiid(s CallSemantics) *StdCiid {
+	switch j.Semantics {
+	case Called.String():
+		s = Called
+	case Contacted.String():
+		s = Contacted
+	}
+	c := &StdCiid{miid: j.stdMiid(), expected: j.Expected, semantics: s}
+	for _, call := range j.Calls {
+		c.ciids = append(c.ciids, call.stdCiid(s))
+	}
+	return c
+}
+
+// MarshalJSON returns the Ciid as nested JSON object with the fields sn, vn,
+// va, t, expected, semantics and calls
+func (c StdCiid) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONGraph(&c))
+}
+
+// UnmarshalJSON sets c from a JSON object as returned by MarshalJSON
+func (c *StdCiid) UnmarshalJSON(data []byte) error {
+	j := new(jsonCiid)
+	if err := json.Unmarshal(data, j); err != nil {
+		return err
+	}
+	*c = *j.stdCiid(Called)
+	return nil
+}
+
+// MarshalText returns the canonical string representation of the Ciid
+func (c StdCiid) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText sets c from its canonical string representation
+func (c *StdCiid) UnmarshalText(text []byte) error {
+	ciid, err := ParseCiid(string(text))
+	if err != nil {
+		return err
+	}
+	*c = *ciid
+	return nil
+}
+
+// MarshalJSON returns the Miid as JSON object with the fields sn, vn, va and t
+func (m StdMiid) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonCiid{Sn: m.sn, Vn: m.vn, Va: m.va, T: m.t})
+}
+
+// UnmarshalJSON sets m from a JSON object as returned by MarshalJSON
+func (m *StdMiid) UnmarshalJSON(data []byte) error {
+	j := new(jsonCiid)
+	if err := json.Unmarshal(data, j); err != nil {
+		return err
+	}
+	*m = *j.stdMiid()
+	return nil
+}
+
+// MarshalText returns the canonical string representation of the Miid
+func (m StdMiid) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText sets m from its canonical string representation
+func (m *StdMiid) UnmarshalText(text []byte) error {
+	miid, err := ParseMiid(string(text))
+	if err != nil {
+		return err
+	}
+	*m = *miid
+	return nil
+}
+
+// MarshalJSON returns the Ciid as nested JSON object, see StdCiid.MarshalJSON
+func (c ImmutableCiid) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONGraph(c))
+}
+
+// MarshalText returns the canonical string representation of the Ciid
+func (c ImmutableCiid) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// MarshalJSON returns the Miid as JSON object, see StdMiid.MarshalJSON
+func (m ImmutableMiid) MarshalJSON() ([]byte, error) {
+	return m.m.MarshalJSON()
+}
+
+// MarshalText returns the canonical string representation of the Miid
+func (m ImmutableMiid) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// jsonIRequest is the JSON representation of an IidRequest, e.g.
+//
+//	{"key":"caffee","options":["c","v"]}
+//
+// key and options are omitted if not set.
+type jsonIRequest struct {
+	Key     string   `json:"key,omitempty"`
+	Options []string `json:"options,omitempty"`
+}
+
+// MarshalJSON returns the IRequest as JSON object with the fields key and options
+func (r IRequest) MarshalJSON() ([]byte, error) {
+	j := jsonIRequest{}
+	if r.HasKey() {
+		j.Key = r.key
+	}
+	for k := range r.options {
+		j.Options = append(j.Options, k)
+	}
+	sort.Strings(j.Options)
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON sets r from a JSON object as returned by MarshalJSON
+func (r *IRequest) UnmarshalJSON(data []byte) error {
+	j := jsonIRequest{}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	r.SetIidAuth(j.Key)
+	r.options = Options{}
+	for _, o := range j.Options {
+		r.SetOption(IOption{commandName: o})
+	}
+	return nil
+}
+
+// MarshalText returns the canonical iid-request value string representation
+func (r IRequest) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText sets r from an iid-request value string
+func (r *IRequest) UnmarshalText(text []byte) error {
+	req, err := ParseIRequest(string(text))
+	if err != nil {
+		return err
+	}
+	*r = *req
+	return nil
+}
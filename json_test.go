@@ -0,0 +1,125 @@
+package instanceid
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStdCiid_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		ciid string
+		want string
+	}{
+		{
+			"miid",
+			"msA/1.1%22s",
+			`{"sn":"msA","vn":"1.1","t":22}`,
+		},
+		{
+			"with va",
+			"msA/1.1/feature-branch-2345abcd%-1s",
+			`{"sn":"msA","vn":"1.1","va":"feature-branch-2345abcd","t":-1}`,
+		},
+		{
+			"call graph",
+			"msA/1.1%22s(msB/2.2%33s(msC/3.3/x%44s)+msD/4.4%55s)",
+			`{"sn":"msA","vn":"1.1","t":22,"calls":[` +
+				`{"sn":"msB","vn":"2.2","t":33,"calls":[{"sn":"msC","vn":"3.3","va":"x","t":44}]},` +
+				`{"sn":"msD","vn":"4.4","t":55}]}`,
+		},
+		{
+			"escaped",
+			"msA/1.1/a%2Bb%22s",
+			`{"sn":"msA","vn":"1.1","va":"a+b","t":22}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewStdCiid(tt.ciid)
+			got, err := json.Marshal(c)
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("json.Marshal() = %s, %v, want %v", got, err, tt.want)
+			}
+
+			// as part of a map, like gin.H
+			got, err = json.Marshal(map[string]interface{}{"ciid": Ciid(c)})
+			if err != nil || string(got) != `{"ciid":`+tt.want+`}` {
+				t.Errorf("json.Marshal() = %s, %v, want %v", got, err, tt.want)
+			}
+
+			u := new(StdCiid)
+			if err := json.Unmarshal([]byte(tt.want), u); err != nil || !reflect.DeepEqual(u, c) {
+				t.Errorf("json.Unmarshal() = %v, %v, want %v", u, err, c)
+			}
+		})
+	}
+}
+
+func TestStdCiid_MarshalText(t *testing.T) {
+	d := map[string]interface{}{
+		"ciid": NewStdCiid("msA/1.1%22s(msB/2.2%33s)"),
+		"miid": NewStdMiid("msA/1.1%22s"),
+	}
+	got, err := json.Marshal(d)
+	want := `{"ciid":{"sn":"msA","vn":"1.1","t":22,"calls":[{"sn":"msB","vn":"2.2","t":33}]},"miid":{"sn":"msA","vn":"1.1","t":22}}`
+	if err != nil || string(got) != want {
+		t.Errorf("json.Marshal() = %s, %v, want %v", got, err, want)
+	}
+
+	// map keys use the text representation
+	keys := map[StdMiid]int{*NewStdMiid("msA/1.1%22s"): 1}
+	got, err = json.Marshal(keys)
+	if err != nil || string(got) != `{"msA/1.1%22s":1}` {
+		t.Errorf("json.Marshal() = %s, %v", got, err)
+	}
+	back := map[StdMiid]int{}
+	if err := json.Unmarshal(got, &back); err != nil || !reflect.DeepEqual(back, keys) {
+		t.Errorf("json.Unmarshal() = %v, %v, want %v", back, err, keys)
+	}
+
+	c := new(StdCiid)
+	if err := c.UnmarshalText([]byte("msA/1.1%22s(msB/2.2%33s)")); err != nil || c.String() != "msA/1.1%22s(msB/2.2%33s)" {
+		t.Errorf("StdCiid.UnmarshalText() = %v, %v", c, err)
+	}
+	if err := c.UnmarshalText([]byte("msA/1.1%22s(")); err == nil {
+		t.Errorf("StdCiid.UnmarshalText() error = nil, want ParseError")
+	}
+	if text, _ := c.MarshalText(); string(text) != "msA/1.1%22s(msB/2.2%33s)" {
+		t.Errorf("StdCiid.MarshalText() = %s, want unchanged value", text)
+	}
+}
+
+func TestIRequest_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		req  string
+		want string
+	}{
+		{"empty", "empty", `{}`},
+		{"key", "key=caffee", `{"key":"caffee"}`},
+		{"key and options", "key=caffee options=vc", `{"key":"caffee","options":["c","v"]}`},
+		{"options", "empty options=s", `{"options":["s"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewIRequestFromString(tt.req)
+			got, err := json.Marshal(r)
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("json.Marshal() = %s, %v, want %v", got, err, tt.want)
+			}
+
+			u := new(IRequest)
+			if err := json.Unmarshal(got, u); err != nil || !reflect.DeepEqual(u, r) {
+				t.Errorf("json.Unmarshal() = %#v, %v, want %#v", u, err, r)
+			}
+
+			text, _ := r.MarshalText()
+			u = new(IRequest)
+			if err := u.UnmarshalText(text); err != nil || !reflect.DeepEqual(u, r) {
+				t.Errorf("IRequest.UnmarshalText() = %#v, %v, want %#v", u, err, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package instanceid
+
+// ParserOptions limits the size of the Ciids accepted by ParseCiidWithOptions.
+// A zero value for any limit means no limit.
+type ParserOptions struct {
+	// Strict enforces the character classes of the Ciid grammar, see Validate
+	Strict bool
+
+	// MaxBytes is the maximum length of the complete Ciid in bytes
+	MaxBytes int
+
+	// MaxDepth is the maximum nesting depth of the call graph. A single Miid
+	// has depth 1.
+	MaxDepth int
+
+	// MaxChildren is the maximum number of calls listed by one Ciid
+	MaxChildren int
+
+	// MaxNodes is the maximum number of Ciids in the complete call graph,
+	// including the outermost one
+	MaxNodes int
+
+	// MaxVaLength is the maximum length of the Va of any Miid in bytes
+	MaxVaLength int
+}
+
+// DefaultParserOptions are safe limits for Ciids received in X-Instance-Id
+// headers from untrusted sources
+var DefaultParserOptions = ParserOptions{
+	MaxBytes:    8192,
+	MaxDepth:    32,
+	MaxChildren: 64,
+	MaxNodes:    256,
+	MaxVaLength: 128,
+}
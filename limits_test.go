@@ -0,0 +1,106 @@
+package instanceid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCiidWithOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		opts       ParserOptions
+		wantKind   ErrorKind
+		wantOffset int
+		want       string
+	}{
+		{
+			"no limits",
+			deepCiid(100),
+			ParserOptions{},
+			0, 0,
+			deepCiid(100),
+		},
+		{
+			"within defaults",
+			"msa/1.1/dev%11s(msb/2.2%22s(msc/3.3%33s)+msd/4.4%44s)",
+			DefaultParserOptions,
+			0, 0,
+			"msa/1.1/dev%11s(msb/2.2%22s(msc/3.3%33s)+msd/4.4%44s)",
+		},
+		{
+			"too long",
+			"msa/1.1%11s(msb/2.2%22s)",
+			ParserOptions{MaxBytes: 12},
+			KindTooLong, 12,
+			"",
+		},
+		{
+			"exactly max depth",
+			"a/1%1s(b/1%1s(c/1%1s))",
+			ParserOptions{MaxDepth: 3},
+			0, 0,
+			"a/1%1s(b/1%1s(c/1%1s))",
+		},
+		{
+			"too deep",
+			"a/1%1s(b/1%1s(c/1%1s(d/1%1s)))",
+			ParserOptions{MaxDepth: 3},
+			KindTooDeep, 21,
+			"a/1%1s(b/1%1s(c/1%1s))",
+		},
+		{
+			"too many children",
+			"a/1%1s(b/1%1s+c/1%1s+d/1%1s)",
+			ParserOptions{MaxChildren: 2},
+			KindTooManyChildren, 21,
+			"a/1%1s(b/1%1s+c/1%1s)",
+		},
+		{
+			"too many nodes",
+			"a/1%1s(b/1%1s(c/1%1s)+d/1%1s)",
+			ParserOptions{MaxNodes: 3},
+			KindTooManyNodes, 22,
+			"a/1%1s(b/1%1s(c/1%1s))",
+		},
+		{
+			"va too long",
+			"a/1/abcdef%1s(b/1/abc%1s)",
+			ParserOptions{MaxVaLength: 5},
+			KindVaTooLong, 4,
+			"a/1/abcdef%1s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCiidWithOptions(tt.id, tt.opts)
+			if got.String() != tt.want {
+				t.Errorf("ParseCiidWithOptions() = %v, want %v", got, tt.want)
+			}
+			if tt.wantKind == 0 {
+				if err != nil {
+					t.Errorf("ParseCiidWithOptions() error = %v, want nil", err)
+				}
+				return
+			}
+			pErr, ok := err.(*ParseError)
+			if !ok || pErr.Kind != tt.wantKind || pErr.Offset != tt.wantOffset {
+				t.Errorf("ParseCiidWithOptions() error = %v, want %v at offset %v", err, tt.wantKind, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestParseCiidWithOptions_hostile(t *testing.T) {
+	id := strings.Repeat("a/1%1s(", 100000)
+	_, err := ParseCiidWithOptions(id, DefaultParserOptions)
+	if pErr, ok := err.(*ParseError); !ok || pErr.Kind != KindTooLong {
+		t.Errorf("ParseCiidWithOptions() error = %v, want %v", err, KindTooLong)
+	}
+
+	id = id[:DefaultParserOptions.MaxBytes-1]
+	_, err = ParseCiidWithOptions(id, DefaultParserOptions)
+	if pErr, ok := err.(*ParseError); !ok || pErr.Kind != KindTooDeep {
+		t.Errorf("ParseCiidWithOptions() error = %v, want %v", err, KindTooDeep)
+	}
+}
@@ -0,0 +1,105 @@
+package messaging
+
+import "fmt"
+
+// MapCarrier adapts string attributes, e.g. the Attributes of a Google
+// Cloud Pub/Sub message or the string message attributes of SQS and SNS
+type MapCarrier map[string]string
+
+// Get implements Carrier
+func (m MapCarrier) Get(key string) string {
+	return m[key]
+}
+
+// Set implements Carrier
+func (m MapCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+// MultiMapCarrier adapts multi-valued headers, e.g. nats.Header. Keys are
+// matched exactly, unlike http.Header.
+type MultiMapCarrier map[string][]string
+
+// Get implements Carrier
+func (m MultiMapCarrier) Get(key string) string {
+	if v := m[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Set implements Carrier
+func (m MultiMapCarrier) Set(key, value string) {
+	m[key] = []string{value}
+}
+
+// TableCarrier adapts field tables, e.g. the Headers of an AMQP 0-9-1
+// message as amqp.Table. Values set are strings, []byte values are read as
+// strings.
+type TableCarrier map[string]interface{}
+
+// Get implements Carrier
+func (t TableCarrier) Get(key string) string {
+	switch v := t[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Set implements Carrier
+func (t TableCarrier) Set(key, value string) {
+	t[key] = value
+}
+
+// KafkaCarrier adapts the Headers of a Kafka message through accessors of
+// the client library's header slice, e.g. for segmentio/kafka-go
+//
+//	c := messaging.KafkaCarrier{
+//		Len:    func() int { return len(msg.Headers) },
+//		Header: func(i int) (string, []byte) { return msg.Headers[i].Key, msg.Headers[i].Value },
+//		SetHeader: func(i int, key string, value []byte) {
+//			if i == len(msg.Headers) {
+//				msg.Headers = append(msg.Headers, kafka.Header{})
+//			}
+//			msg.Headers[i] = kafka.Header{Key: key, Value: value}
+//		},
+//	}
+//
+// Get returns the first header with the key. Set replaces the value of every
+// header with the key, or appends the header with i == Len().
+type KafkaCarrier struct {
+	Len       func() int
+	Header    func(i int) (key string, value []byte)
+	SetHeader func(i int, key string, value []byte)
+}
+
+// Get implements Carrier
+func (h KafkaCarrier) Get(key string) string {
+	for i, n := 0, h.Len(); i < n; i++ {
+		if k, v := h.Header(i); k == key {
+			return string(v)
+		}
+	}
+	return ""
+}
+
+// Set implements Carrier
+func (h KafkaCarrier) Set(key, value string) {
+	n := h.Len()
+	set := false
+	for i := 0; i < n; i++ {
+		if k, _ := h.Header(i); k == key {
+			h.SetHeader(i, key, []byte(value))
+			set = true
+		}
+	}
+	if !set {
+		h.SetHeader(n, key, []byte(value))
+	}
+}
@@ -0,0 +1,87 @@
+// Package messaging carries Ciids across asynchronous hops. The producer
+// stamps its Ciid into the headers of a message, the consumer records the
+// processing of the message as called by the producer.
+package messaging
+
+import (
+	"context"
+	"time"
+
+	iid "github.com/theovassiliou/instanceidentification"
+)
+
+// Carrier is the headers of a message
+type Carrier interface {
+	// Get returns the value of key, or "" if not set
+	Get(key string) string
+
+	// Set sets key to value
+	Set(key, value string)
+}
+
+// Stamp sets the X-Instance-Id header of c to ciid
+func Stamp(c Carrier, ciid iid.Ciid) {
+	c.Set(iid.XINSTANCEID, ciid.String())
+}
+
+// Inject stamps the part of the Ciid recorded so far by the Recorder carried
+// by ctx that p discloses into c, see iid.RecorderFrom and
+// iid.DisclosurePolicy. A message carries no iid-request, so p applies as
+// to an iid-request without options. Without Recorder c is unchanged.
+func Inject(ctx context.Context, c Carrier, p iid.DisclosurePolicy) {
+	if rec := iid.RecorderFrom(ctx); rec != nil {
+		Stamp(c, p.Disclose(nil, rec.Ciid()))
+	}
+}
+
+// Extract returns the Ciid stamped into c, or nil if c carries no valid Ciid
+func Extract(c Carrier) iid.Ciid {
+	v := c.Get(iid.XINSTANCEID)
+	if v == "" {
+		return nil
+	}
+	ciid, err := iid.ParseCiidWithOptions(v, iid.DefaultParserOptions)
+	if err != nil {
+		return nil
+	}
+	return ciid
+}
+
+// Span is the processing of one message by a consumer
+type Span struct {
+	producer iid.Ciid
+	recorder *iid.Recorder
+}
+
+// Begin begins the processing of the message with headers c by the service
+// identified by miid. It returns ctx with the Recorder of the span, see
+// iid.RecorderFrom.
+func Begin(ctx context.Context, c Carrier, miid iid.Miid, startTime time.Time) (context.Context, *Span) {
+	s := &Span{producer: Extract(c), recorder: iid.NewRecorder(miid, startTime)}
+	return iid.WithRecorder(ctx, s.recorder), s
+}
+
+// Producer returns the Ciid of the producer of the message, or nil if the
+// message has not been stamped
+func (s *Span) Producer() iid.Ciid {
+	return s.producer
+}
+
+// Recorder returns the Recorder of the span
+func (s *Span) Recorder() *iid.Recorder {
+	return s.recorder
+}
+
+// Ciid returns the Ciid of the producer calling the consumer with the calls
+// recorded so far. Without producer it returns the Ciid of the consumer.
+func (s *Span) Ciid() iid.Ciid {
+	c := s.recorder.Ciid()
+	if s.producer == nil {
+		return c
+	}
+	p := iid.Canonical(s.producer, iid.Called)
+	calls := p.Ciids()
+	calls.Push(c)
+	p.SetCiids(calls)
+	return p
+}
@@ -0,0 +1,167 @@
+package messaging
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	iid "github.com/theovassiliou/instanceidentification"
+	"github.com/theovassiliou/instanceidentification/messaging/internal/kafkatest"
+)
+
+// stand-ins of the message headers of client libraries
+type (
+	pubsubMessage struct{ Attributes map[string]string }
+	natsHeader    map[string][]string
+	amqpTable     map[string]interface{}
+)
+
+// kafkaCarrier adapts the Headers of msg
+func kafkaCarrier(msg *kafkatest.Message) KafkaCarrier {
+	return KafkaCarrier{
+		Len:    func() int { return len(msg.Headers) },
+		Header: func(i int) (string, []byte) { return msg.Headers[i].Key, msg.Headers[i].Value },
+		SetHeader: func(i int, key string, value []byte) {
+			if i == len(msg.Headers) {
+				msg.Headers = append(msg.Headers, kafkatest.Header{})
+			}
+			msg.Headers[i] = kafkatest.Header{Key: key, Value: value}
+		},
+	}
+}
+
+// queue is an in-memory message queue with headers adapted by carrier
+type queue struct {
+	name    string
+	carrier func() Carrier
+}
+
+var queues = []queue{
+	{"pubsub", func() Carrier { return MapCarrier(pubsubMessage{Attributes: map[string]string{}}.Attributes) }},
+	{"nats", func() Carrier { return MultiMapCarrier(natsHeader{}) }},
+	{"amqp", func() Carrier { return TableCarrier(amqpTable{}) }},
+	{"kafka", func() Carrier { return kafkaCarrier(&kafkatest.Message{}) }},
+}
+
+func TestProduceConsume(t *testing.T) {
+	for _, q := range queues {
+		t.Run(q.name, func(t *testing.T) {
+			// producer
+			rec := iid.NewRecorder(iid.NewStdMiid("producer/1%-1s"), time.Now())
+			rec.Record(iid.NewStdCiid("db/1%1s"))
+			headers := q.carrier()
+			Inject(iid.WithRecorder(context.Background(), rec), headers, iid.DisclosurePolicy{})
+
+			// consumer
+			ctx, span := Begin(context.Background(), headers, iid.NewStdMiid("consumer/2%-1s"), time.Now())
+			iid.RecorderFrom(ctx).Record(iid.NewStdCiid("cache/1%1s"))
+
+			if got, want := span.Producer().String(), "producer/1%0s(db/1%1s)"; got != want {
+				t.Errorf("Producer() = %v, want %v", got, want)
+			}
+			if got, want := span.Ciid().String(), "producer/1%0s(db/1%1s+consumer/2%0s(cache/1%1s))"; got != want {
+				t.Errorf("Ciid() = %v, want %v", got, want)
+			}
+			// the producer's Ciid is not changed
+			if got, want := span.Producer().String(), "producer/1%0s(db/1%1s)"; got != want {
+				t.Errorf("Producer() = %v after Ciid(), want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBegin_notStamped(t *testing.T) {
+	for _, q := range queues {
+		t.Run(q.name, func(t *testing.T) {
+			headers := q.carrier()
+			Inject(context.Background(), headers, iid.DisclosurePolicy{})
+			if got := headers.Get(iid.XINSTANCEID); got != "" {
+				t.Errorf("X-Instance-Id = %v without Recorder, want none", got)
+			}
+
+			_, span := Begin(context.Background(), headers, iid.NewStdMiid("consumer/2%-1s"), time.Now())
+			if span.Producer() != nil {
+				t.Errorf("Producer() = %v, want nil", span.Producer())
+			}
+			if got, want := span.Ciid().String(), "consumer/2%0s"; got != want {
+				t.Errorf("Ciid() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestInject_policy(t *testing.T) {
+	rec := iid.NewRecorder(iid.NewStdMiid("producer/1/main-ab12%-1s"), time.Now())
+	rec.Record(iid.NewStdCiid("db/1/eu%1s(storage/2%2s)"))
+	ctx := iid.WithRecorder(context.Background(), rec)
+	tests := []struct {
+		name   string
+		policy iid.DisclosurePolicy
+		want   string
+	}{
+		{"zero", iid.DisclosurePolicy{}, "producer/1/main-ab12%0s(db/1/eu%1s(storage/2%2s))"},
+		{"shallow", iid.DisclosurePolicy{Default: iid.Shallow}, "producer/1/main-ab12%0s"},
+		{"max depth", iid.DisclosurePolicy{MaxDepth: 2}, "producer/1/main-ab12%0s(db/1/eu%1s)"},
+		{"va on request", iid.DisclosurePolicy{Va: iid.DiscloseVaOnRequest}, "producer/1%0s(db/1%1s(storage/2%2s))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := MapCarrier{}
+			Inject(ctx, headers, tt.policy)
+			if got := headers.Get(iid.XINSTANCEID); got != tt.want {
+				t.Errorf("X-Instance-Id = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKafkaCarrier(t *testing.T) {
+	msg := kafkatest.Message{Headers: []kafkatest.Header{
+		{Key: iid.XINSTANCEID, Value: []byte("old/1%1s")},
+		{Key: "trace", Value: []byte("abc")},
+		{Key: iid.XINSTANCEID, Value: []byte("older/1%1s")},
+	}}
+	c := kafkaCarrier(&msg)
+	if got := c.Get(iid.XINSTANCEID); got != "old/1%1s" {
+		t.Errorf("Get() = %v, want the first header", got)
+	}
+	Stamp(c, iid.NewStdCiid("producer/1%3s"))
+	want := []kafkatest.Header{
+		{Key: iid.XINSTANCEID, Value: []byte("producer/1%3s")},
+		{Key: "trace", Value: []byte("abc")},
+		{Key: iid.XINSTANCEID, Value: []byte("producer/1%3s")},
+	}
+	if !reflect.DeepEqual(msg.Headers, want) {
+		t.Errorf("Headers = %q, want %q", msg.Headers, want)
+	}
+	if got := Extract(c).String(); got != "producer/1%3s" {
+		t.Errorf("Extract() = %v, want producer/1%%3s", got)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		carrier Carrier
+		want    string
+	}{
+		{"stamped", MapCarrier{iid.XINSTANCEID: "producer/1%3s"}, "producer/1%3s"},
+		{"invalid", MapCarrier{iid.XINSTANCEID: "producer"}, ""},
+		{"bytes", TableCarrier{iid.XINSTANCEID: []byte("producer/1%3s")}, "producer/1%3s"},
+		{"other key", MultiMapCarrier{"x-instance-id": {"producer/1%3s"}}, ""},
+		{"empty", MultiMapCarrier{iid.XINSTANCEID: {}}, ""},
+		{"kafka", kafkaCarrier(&kafkatest.Message{Headers: []kafkatest.Header{{Key: iid.XINSTANCEID, Value: []byte("producer/1%3s")}}}), "producer/1%3s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if c := Extract(tt.carrier); c != nil {
+				got = c.String()
+			}
+			if got != tt.want {
+				t.Errorf("Extract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
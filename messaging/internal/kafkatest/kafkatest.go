@@ -0,0 +1,14 @@
+// Package kafkatest stands in for a Kafka client library, e.g.
+// segmentio/kafka-go, whose header type is declared outside of messaging.
+package kafkatest
+
+// Header is a message header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is a message with headers
+type Message struct {
+	Headers []Header
+}
@@ -13,8 +13,22 @@ type StdMiid struct {
 	t  int
 }
 
+// NewStdMiid creates a new Miid from a string in the form of Sn/Vn/Va%ts.
+// Parse errors are ignored, use ParseMiid to detect them.
 func NewStdMiid(s string) *StdMiid {
-	return parseMIID(s)
+	miid, _ := ParseMiid(s)
+	return miid
+}
+
+// ParseMiid creates a new Miid like NewStdMiid, but reports the first
+// violation of the Miid grammar as *ParseError. In case of an error the
+// returned Miid holds what could be parsed, identical to NewStdMiid.
+func ParseMiid(s string) (*StdMiid, error) {
+	miid := new(StdMiid)
+	if err := scanMiid(miid, s); err != nil {
+		return miid, err
+	}
+	return miid, nil
 }
 
 func (m StdMiid) Sn() string {
@@ -38,16 +52,17 @@ func (m *StdMiid) SetT(t int) Miid {
 	return m
 }
 
-// String returns the textual representation of the Miid
+// String returns the textual representation of the Miid. Reserved characters
+// in Sn, Vn and Va are escaped, see EscapeName and EscapeVa.
 func (m *StdMiid) String() string {
 	sB := strings.Builder{}
 	if m.sn != "" {
-		sB.WriteString(m.sn)
+		sB.WriteString(EscapeName(m.sn))
 		if m.vn != "" {
-			sB.WriteString("/" + m.vn)
+			sB.WriteString("/" + EscapeName(m.vn))
 		}
 		if m.va != "" {
-			sB.WriteString("/" + m.va)
+			sB.WriteString("/" + EscapeVa(m.va))
 		}
 		sB.WriteString("%" + strconv.Itoa(m.t) + "s")
 	}
@@ -71,79 +86,78 @@ func (m *StdMiid) SetEpoch(startTime time.Time) Miid {
 
 func parseMIID(id string) (miid *StdMiid) {
 	miid = new(StdMiid)
-	if !SanityCheck(id) {
-		return miid
-	}
-	s := strings.SplitN(id, "/", -1)
-	l := len(s)
+	scanMiid(miid, id)
+	return miid
+}
 
-	var r = new(StdMiid)
-	if l >= 1 {
-		r.sn = s[0]
-	}
-	if l == 2 {
-		e := strings.Split(s[1], "%")
-		r.vn = e[0]
-		if len(e) > 1 {
-			t, err := strconv.Atoi(strings.Split(e[1], "s")[0])
-			if err != nil {
-				return miid
-			}
-
-			r.t = t
+// scanMiid fills m from the given MIID in a single pass. In case of a
+// violation of the MIID grammar m is left empty and the violation is returned
+// with an offset relative to miid.
+func scanMiid(m *StdMiid, miid string) *ParseError {
+	fail := func(kind ErrorKind, pos int, token string) *ParseError {
+		return &ParseError{
+			Input:     miid,
+			Violation: Violation{Offset: pos, Token: token, Kind: kind},
 		}
-	} else if l >= 2 {
-		r.vn = s[1]
 	}
 
-	if l >= 3 {
-		e := strings.Split(s[len(s)-1], "%")
-
-		rest := s[2:]
-		va := strings.Builder{}
-		for i := 0; i < len(rest)-1; i++ {
-			va.WriteString(rest[i])
-			va.WriteString("/")
-		}
-		va.WriteString(e[0])
-		r.va = va.String()
-
-		t, err := strconv.Atoi(strings.Split(e[1], "s")[0])
-		if err == nil {
-			r.t = t
-		} else {
-			return miid
-		}
+	if miid == "" {
+		return fail(KindEmpty, 0, "")
 	}
-
-	return r
-}
-
-// SanityCheck checks the given miid against some rules to ensure that it can be an Miid
-// returns true if miid could be an Miid false otherwise
-func SanityCheck(miid string) bool {
-	miid = strings.TrimSpace(miid)
-
-	if !strings.Contains(miid, "%") {
-		return false
+	if i := strings.IndexAny(miid, "+()"); i >= 0 {
+		return fail(KindUnexpectedToken, i, miid[i:i+1])
 	}
 
-	// last rune must be s
-	if !strings.HasSuffix(miid, "s") {
-		return false
+	// <sN> "/"
+	slash := strings.IndexByte(miid, '/')
+	if slash == 0 {
+		return fail(KindMissingName, 0, miid)
 	}
-
-	// at least two /
-	s := strings.Count(miid, "/")
-	if s < 1 || s > 3 {
-		return false
+	if slash < 0 {
+		return fail(KindMissingVersion, len(miid), miid)
 	}
 
-	// no '+', no '(' no ')'
+	// <vN> ["/" <vA>] "%", the last '%' introduces the epoch, any other
+	// '%' belongs to an escape sequence
+	pct := strings.LastIndexByte(miid, '%')
+	body := miid
+	if pct > slash {
+		body = miid[:pct]
+	}
+	vnEnd := slash + 1 + strings.IndexByte(body[slash+1:], '/')
+	if vnEnd == slash {
+		vnEnd = len(body)
+	}
+	if vnEnd == slash+1 {
+		return fail(KindMissingVersion, slash+1, miid)
+	}
+	if pct < slash {
+		return fail(KindMissingPercent, len(miid), miid)
+	}
+	var va string
+	if vnEnd < len(body) {
+		va = body[vnEnd+1:]
+	}
 
-	if strings.ContainsAny(miid, "+()") {
-		return false
+	// <t> "s"
+	if !strings.HasSuffix(miid[pct+1:], "s") {
+		return fail(KindMissingSuffix, len(miid), miid[pct:])
+	}
+	epoch := miid[pct+1 : len(miid)-1]
+	t, err := strconv.Atoi(epoch)
+	if err != nil {
+		return fail(KindInvalidEpoch, pct+1, epoch)
 	}
 
-	return true
+	m.sn = Unescape(miid[:slash])
+	m.vn = Unescape(miid[slash+1 : vnEnd])
+	m.va = Unescape(va)
+	m.t = t
+	return nil
+}
+
+// SanityCheck checks the given miid against the MIID grammar, see Validate.
+// returns true if miid could be an Miid false otherwise
+func SanityCheck(miid string) bool {
+	return len(validateMiid(strings.TrimSpace(miid))) == 0
 }
@@ -0,0 +1,265 @@
+// Package nethttp makes net/http services IID aware. Middleware answers
+// iid-requests with the Ciid of the service, including the Ciids of the
+// services called while handling the request.
+package nethttp
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	iid "github.com/theovassiliou/instanceidentification"
+)
+
+// Config configures Middleware
+type Config struct {
+	// Miid identifies the service
+	Miid iid.Miid
+
+	// StartTime is the start time of the service, the epoch is relative to it
+	StartTime time.Time
+
+	// Mode is the recording mode of the Recorder carried by the request context
+	Mode iid.RecordingMode
+
+	// Signer signs the Ciid sent in response, see iid.Sign. The Signatures
+	// are sent in an X-Instance-Id-Signature header. If nil, or if the Ciid
+	// is sealed, the Ciid is not signed.
+	Signer iid.Signer
+
+	// KeyID identifies the key of Signer
+	KeyID string
+
+	// Seal seals the Ciid sent in response with the seal key Authorizer
+	// grants to the key of the iid-request, see iid.Seal and
+	// iid.Grant.SealKey. iid-requests without seal key are not answered
+	// then. iid-requests with iid.OptionSealed are always sealed.
+	Seal bool
+
+	// Authorizer decides whether an iid-request is answered and caps the
+	// disclosure. If nil every iid-request is answered.
+	Authorizer iid.Authorizer
+
+	// Policy decides which part of the recorded Ciid is sent in response to
+	// an iid-request, including its call semantics
+	Policy iid.DisclosurePolicy
+}
+
+// Middleware returns a middleware answering iid-requests. If a request
+// carries an X-Instance-Id header with an authorised iid-request, the
+// request context carries a Recorder, see iid.RecorderFrom, and the response
+// carries the Ciid with the recorded calls in an X-Instance-Id header. The
+// header is set once, when the handler writes the header or the body.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, e := cfg.Start(r)
+			if e == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rw := &responseWriter{ResponseWriter: w, exchange: e}
+			next.ServeHTTP(wrap(rw), r)
+			e.SetHeader(w.Header())
+		})
+	}
+}
+
+// Start starts answering the iid-request carried by r. It returns r with a
+// Recorder in its context and the Exchange setting the response header, or
+// r and nil if r carries no authorised iid-request. Start is the core of
+// Middleware for adapters to other frameworks.
+func (cfg *Config) Start(r *http.Request) (*http.Request, *Exchange) {
+	ctx, e := cfg.Begin(r.Context(), r.Header.Get(iid.XINSTANCEID))
+	if e == nil {
+		return r, nil
+	}
+	return r.WithContext(ctx), e
+}
+
+// Begin starts answering the iid-request value received by a request with
+// context ctx, like Start does for HTTP requests. It is the core of Start for
+// adapters to other protocols.
+func (cfg *Config) Begin(ctx context.Context, value string) (context.Context, *Exchange) {
+	ir, grant := cfg.request(value)
+	if ir == nil {
+		return ctx, nil
+	}
+	e := &Exchange{
+		cfg:      cfg,
+		policy:   cfg.Policy.Limit(grant.Scope),
+		request:  ir,
+		sealKey:  grant.SealKey,
+		recorder: iid.NewRecorder(cfg.Miid, cfg.StartTime).SetMode(cfg.Mode),
+	}
+	return iid.WithRecorder(ctx, e.recorder), e
+}
+
+// request returns the authorised iid-request of value and its grant, or nil
+func (cfg *Config) request(value string) (iid.IidRequest, iid.Grant) {
+	if value == "" || len(value) > iid.DefaultParserOptions.MaxBytes {
+		return nil, iid.Grant{}
+	}
+	ir := iid.NewIRequestFromString(value)
+	if cfg.Authorizer == nil {
+		return ir, iid.Grant{Scope: iid.Deep}
+	}
+	grant, ok := cfg.Authorizer.Authorize(ir)
+	if !ok {
+		return nil, iid.Grant{}
+	}
+	return ir, grant
+}
+
+// Exchange answers one authorised iid-request, see Config.Start. It is not
+// safe for concurrent use, like an http.ResponseWriter.
+type Exchange struct {
+	cfg      *Config
+	policy   iid.DisclosurePolicy
+	request  iid.IidRequest
+	sealKey  []byte
+	recorder *iid.Recorder
+	done     bool
+}
+
+// Request returns the iid-request
+func (e *Exchange) Request() iid.IidRequest {
+	return e.request
+}
+
+// Recorder returns the Recorder carried by the request context
+func (e *Exchange) Recorder() *iid.Recorder {
+	return e.recorder
+}
+
+// SetHeader sets the X-Instance-Id header, and the X-Instance-Id-Signature
+// header if configured and not sealed, to the Ciid recorded so far in h. Only the first call
+// sets the headers, call it right before the response header is written.
+func (e *Exchange) SetHeader(h http.Header) {
+	if e.done {
+		return
+	}
+	e.done = true
+
+	c := e.policy.Disclose(e.request, e.recorder.Ciid())
+	if e.cfg.Seal || iid.HasOption(e.request, iid.OptionSealed) {
+		if e.sealKey == nil {
+			return
+		}
+		sealed, err := iid.Seal(c, e.sealKey)
+		if err != nil {
+			return
+		}
+		// the signatures would disclose the Miids in plaintext, the sealed
+		// Ciid is authenticated by the seal key
+		h.Set(iid.XINSTANCEID, sealed)
+		return
+	}
+	h.Set(iid.XINSTANCEID, c.String())
+	if e.cfg.Signer != nil {
+		sigs := iid.Sign(c, e.recorder.Signatures(), e.cfg.KeyID, e.cfg.Signer)
+		h.Set(iid.SignatureHeader, sigs.String())
+	}
+}
+
+// Abandon ends the exchange without setting headers, e.g. when the
+// connection has been hijacked
+func (e *Exchange) Abandon() {
+	e.done = true
+}
+
+// responseWriter sets the X-Instance-Id header before the header is written
+type responseWriter struct {
+	http.ResponseWriter
+	exchange *Exchange
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	w.exchange.SetHeader(w.Header())
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.exchange.SetHeader(w.Header())
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, see http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type flusher struct {
+	w *responseWriter
+}
+
+func (f flusher) Flush() {
+	f.w.exchange.SetHeader(f.w.Header())
+	f.w.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijacker struct {
+	w *responseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// the connection is taken over, there is no header to be written
+	h.w.exchange.Abandon()
+	return h.w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// wrap returns w implementing the same of http.Flusher, http.Hijacker and
+// http.Pusher as the http.ResponseWriter it wraps
+func wrap(w *responseWriter) http.ResponseWriter {
+	_, isFlusher := w.ResponseWriter.(http.Flusher)
+	_, isHijacker := w.ResponseWriter.(http.Hijacker)
+	p, isPusher := w.ResponseWriter.(http.Pusher)
+	f, h := flusher{w}, hijacker{w}
+
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case isFlusher && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case isFlusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{w, f}
+	case isHijacker:
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{w, h}
+	case isPusher:
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{w, p}
+	}
+	return w
+}
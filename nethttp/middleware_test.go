@@ -0,0 +1,213 @@
+package nethttp
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	iid "github.com/theovassiliou/instanceidentification"
+)
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	rec := iid.RecorderFrom(r.Context())
+	rec.Record(iid.NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+	rec.Record(iid.NewStdCiid("monitoring/1.1%22242s"))
+	w.WriteHeader(http.StatusAccepted)
+	// calls recorded after the header has been written are lost
+	rec.Record(iid.NewStdCiid("late/1%1s"))
+	w.Write([]byte("ok"))
+}
+
+func TestMiddleware(t *testing.T) {
+	const deep = "ourService/1.1%0s(database/1.2%33s(storageService/0.2%77s)+monitoring/1.1%22242s)"
+	tests := []struct {
+		name    string
+		cfg     Config
+		request string
+		want    string
+	}{
+		{"not requested", Config{}, "", ""},
+		{"empty", Config{}, "empty", deep},
+		{"any key", Config{}, "key=abc", deep},
+		{"key", Config{Authorizer: iid.StaticKeys{"abc": {}, "def": {}}}, "key=def options=v", deep},
+		{"wrong key", Config{Authorizer: iid.StaticKeys{"abc": {}}}, "key=abd", ""},
+		{"missing key", Config{Authorizer: iid.StaticKeys{"abc": {}}}, "empty", ""},
+		{"shallow key", Config{Authorizer: iid.StaticKeys{"abc": {Scope: iid.Shallow}}}, "key=abc options=d", "ourService/1.1%0s"},
+		{"shallow", Config{}, "empty options=s", "ourService/1.1%0s"},
+		{"shallow policy", Config{Policy: iid.DisclosurePolicy{Default: iid.Shallow}}, "empty", "ourService/1.1%0s"},
+		{"deep requested", Config{Policy: iid.DisclosurePolicy{Default: iid.Shallow}}, "empty options=d", deep},
+		{"truncated", Config{Policy: iid.DisclosurePolicy{MaxDepth: 2}}, "empty", "ourService/1.1%0s(database/1.2%33s+monitoring/1.1%22242s)"},
+		{"contacted", Config{}, "empty options=c", "+ourService/1.1%0s(database/1.2%33s(storageService/0.2%77s)+monitoring/1.1%22242s)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Miid = iid.NewStdMiid("ourService/1.1%-1s")
+			tt.cfg.StartTime = time.Now()
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.request != "" {
+				req.Header.Set(iid.XINSTANCEID, tt.request)
+			}
+			w := httptest.NewRecorder()
+			Middleware(tt.cfg)(http.HandlerFunc(handler)).ServeHTTP(w, req)
+
+			if got := w.Header().Get(iid.XINSTANCEID); got != tt.want {
+				t.Errorf("X-Instance-Id = %v, want %v", got, tt.want)
+			}
+			if w.Code != http.StatusAccepted || w.Body.String() != "ok" {
+				t.Errorf("response = %v %v, want %v ok", w.Code, w.Body, http.StatusAccepted)
+			}
+		})
+	}
+}
+
+func TestMiddleware_noWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(iid.XINSTANCEID, "empty")
+	w := httptest.NewRecorder()
+	cfg := Config{Miid: iid.NewStdMiid("ourService/1.1%-1s"), StartTime: time.Now()}
+	Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iid.RecorderFrom(r.Context()).Record(iid.NewStdCiid("db/1%1s"))
+	})).ServeHTTP(w, req)
+
+	if got, want := w.Header().Get(iid.XINSTANCEID), "ourService/1.1%0s(db/1%1s)"; got != want {
+		t.Errorf("X-Instance-Id = %v, want %v", got, want)
+	}
+}
+
+// fullWriter implements every optional interface of an http.ResponseWriter
+type fullWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+	pushed   string
+}
+
+func (w *fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func (w *fullWriter) Push(target string, opts *http.PushOptions) error {
+	w.pushed = target
+	return nil
+}
+
+// plainWriter implements no optional interface
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestMiddleware_interfaces(t *testing.T) {
+	tests := []struct {
+		name string
+		w    http.ResponseWriter
+	}{
+		{"flusher", httptest.NewRecorder()},
+		{"flusher, hijacker and pusher", &fullWriter{ResponseRecorder: httptest.NewRecorder()}},
+		{"none", plainWriter{httptest.NewRecorder()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, wantFlusher := tt.w.(http.Flusher)
+			_, wantHijacker := tt.w.(http.Hijacker)
+			_, wantPusher := tt.w.(http.Pusher)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(iid.XINSTANCEID, "empty")
+			cfg := Config{Miid: iid.NewStdMiid("ourService/1.1%-1s"), StartTime: time.Now()}
+			Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if f, ok := w.(http.Flusher); ok != wantFlusher {
+					t.Errorf("http.Flusher = %v, want %v", ok, wantFlusher)
+				} else if ok {
+					f.Flush()
+				}
+				if _, ok := w.(http.Hijacker); ok != wantHijacker {
+					t.Errorf("http.Hijacker = %v, want %v", ok, wantHijacker)
+				}
+				if p, ok := w.(http.Pusher); ok != wantPusher {
+					t.Errorf("http.Pusher = %v, want %v", ok, wantPusher)
+				} else if ok {
+					p.Push("/style.css", nil)
+				}
+			})).ServeHTTP(tt.w, req)
+
+			if got := tt.w.Header().Get(iid.XINSTANCEID); got != "ourService/1.1%0s" {
+				t.Errorf("X-Instance-Id = %v, want ourService/1.1%%0s", got)
+			}
+			if fw, ok := tt.w.(*fullWriter); ok && fw.pushed != "/style.css" {
+				t.Errorf("Push() not forwarded")
+			}
+		})
+	}
+}
+
+func TestMiddleware_hijack(t *testing.T) {
+	fw := &fullWriter{ResponseRecorder: httptest.NewRecorder()}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(iid.XINSTANCEID, "empty")
+	cfg := Config{Miid: iid.NewStdMiid("ourService/1.1%-1s"), StartTime: time.Now()}
+	Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Hijacker).Hijack()
+	})).ServeHTTP(fw, req)
+
+	if !fw.hijacked {
+		t.Errorf("Hijack() not forwarded")
+	}
+	if got := fw.Header().Get(iid.XINSTANCEID); got != "" {
+		t.Errorf("X-Instance-Id = %v after Hijack, want none", got)
+	}
+}
+
+func TestMiddleware_sealed(t *testing.T) {
+	const deep = "ourService/1.1%0s(database/1.2%33s(storageService/0.2%77s)+monitoring/1.1%22242s)"
+	sealKey := []byte("0123456789abcdef")
+	keys := iid.StaticKeys{"caffee": {Scope: iid.Deep, SealKey: sealKey}, "decaf": {Scope: iid.Deep}}
+	tests := []struct {
+		name    string
+		cfg     Config
+		request string
+		want    string
+		sealed  bool
+	}{
+		{"sealed", Config{Seal: true, Authorizer: keys}, "key=caffee", deep, true},
+		{"sealed without key", Config{Seal: true}, "empty", "", false},
+		{"sealed without seal key", Config{Seal: true, Authorizer: keys}, "key=decaf", "", false},
+		{"sealed on request", Config{Authorizer: keys}, "key=caffee options=e", deep, true},
+		{"sealed on request without key", Config{}, "empty options=e", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Miid = iid.NewStdMiid("ourService/1.1%-1s")
+			tt.cfg.StartTime = time.Now()
+			tt.cfg.Signer = iid.HMACKey("secret")
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.Header.Set(iid.XINSTANCEID, tt.request)
+			w := httptest.NewRecorder()
+			Middleware(tt.cfg)(http.HandlerFunc(handler)).ServeHTTP(w, req)
+
+			// the signatures of a sealed Ciid are not sent in plaintext
+			if sigs := w.Header().Get(iid.SignatureHeader); sigs != "" {
+				t.Errorf("X-Instance-Id-Signature = %v, want none", sigs)
+			}
+			got := w.Header().Get(iid.XINSTANCEID)
+			if tt.sealed {
+				// the key sent in plaintext does not open the Ciid
+				for _, key := range []string{"caffee", "caffeecaffeecaffee"} {
+					if _, err := iid.Open(got, []byte(key)); err == nil {
+						t.Errorf("Open(%v) with the key of the iid-request error = nil, want error", got)
+					}
+				}
+				c, err := iid.Open(got, sealKey)
+				if err != nil {
+					t.Fatalf("Open(%v) error = %v", got, err)
+				}
+				got = c.String()
+			}
+			if got != tt.want {
+				t.Errorf("X-Instance-Id = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
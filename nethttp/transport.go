@@ -0,0 +1,148 @@
+package nethttp
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	iid "github.com/theovassiliou/instanceidentification"
+)
+
+// ClientConfig configures the clients sending iid-requests to the called
+// services, e.g. Transport
+type ClientConfig struct {
+	// Request is the iid-request sent, carrying key and options. If nil
+	// "empty" is sent.
+	Request iid.IidRequest
+
+	// SealKey opens the Ciids the called services seal, the seal key they
+	// grant to the key of Request, see iid.Grant.SealKey
+	SealKey []byte
+
+	// ErrorLog logs the Ciids that cannot be recorded, e.g. invalid Ciids or
+	// Ciids failing with iid.ErrMixedModes. If nil, the log package's
+	// standard logger is used.
+	ErrorLog *log.Logger
+}
+
+// RequestString returns the iid-request sent, "empty" if Request is nil
+func (c *ClientConfig) RequestString() string {
+	if c.Request == nil {
+		return "empty"
+	}
+	return c.Request.String()
+}
+
+// Logf logs to ErrorLog
+func (c *ClientConfig) Logf(format string, args ...interface{}) {
+	if c.ErrorLog != nil {
+		c.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Transport is an http.RoundTripper sending iid-requests to the called
+// services and recording their Ciids into the Recorder carried by the request
+// context, see iid.RecorderFrom. Requests without Recorder are sent
+// unchanged.
+//
+// When recording by confirmation, the Recorder's default, a called service
+// is recorded if, and only if, it responds with a valid Ciid. When recording
+// by expectation every called service is recorded with the Miid returned by
+// Expectation before it is called, and upgraded in place if it responds with
+// a valid Ciid.
+type Transport struct {
+	ClientConfig
+
+	// Base sends the requests. If nil http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Expectation returns the Miid recorded by expectation for req. If nil
+	// ExpectedMiid is used.
+	Expectation func(req *http.Request) iid.Miid
+}
+
+// ExpectedMiid returns the Miid of an external service named after the host
+// called by req, see iid.NewExternalMiid. The target is the scheme, host and
+// path of the url, without user info, query or fragment, which may carry
+// credentials.
+func ExpectedMiid(req *http.Request) iid.Miid {
+	u := url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: req.URL.Path, RawPath: req.URL.RawPath}
+	return iid.NewExternalMiid(req.URL.Hostname(), u.String())
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rec := iid.RecorderFrom(req.Context())
+	if rec == nil {
+		return base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	out := req.Clone(req.Context())
+	out.Header.Set(iid.XINSTANCEID, t.RequestString())
+
+	expected := -1
+	if rec.Mode() == iid.ByExpectation {
+		expectation := t.Expectation
+		if expectation == nil {
+			expectation = ExpectedMiid
+		}
+		var err error
+		if expected, err = rec.Expect(expectation(req)); err != nil {
+			t.Logf("nethttp: expecting %v: %v", req.URL.Host, err)
+		}
+	}
+
+	resp, err := base.RoundTrip(out)
+	if err != nil {
+		return resp, err
+	}
+	if err := RecordResponse(rec, expected, t.SealKey, resp.Header); err != nil {
+		t.Logf("nethttp: recording %v: %v", req.URL.Host, err)
+	}
+	return resp, nil
+}
+
+// RecordResponse records the Ciid in the X-Instance-Id header h of a
+// response into rec, together with its signatures. Sealed Ciids are opened
+// with sealKey, see iid.Open. expected
+// is the index returned by Recorder.Expect, or -1 if the call has not been
+// recorded by expectation. It returns the error of parsing or recording the
+// Ciid, nil if h carries none. RecordResponse is the core of Transport for
+// adapters to other protocols.
+func RecordResponse(rec *iid.Recorder, expected int, sealKey []byte, h http.Header) error {
+	v := h.Get(iid.XINSTANCEID)
+	if v == "" {
+		return nil
+	}
+	c, err := iid.ParseCiidWithOptions(v, iid.DefaultParserOptions)
+	if err != nil && sealKey != nil {
+		// sealed with the seal key granted, see Config.Seal
+		c, err = iid.Open(v, sealKey)
+	}
+	if err != nil {
+		return err
+	}
+	if expected >= 0 {
+		err = rec.Confirm(expected, c)
+	} else {
+		err = rec.Record(c)
+	}
+	if err != nil {
+		return err
+	}
+	if v := h.Get(iid.SignatureHeader); v != "" {
+		sigs, err := iid.ParseSignatures(v)
+		if err != nil {
+			return err
+		}
+		rec.AddSignatures(c, sigs)
+	}
+	return nil
+}
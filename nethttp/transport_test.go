@@ -0,0 +1,294 @@
+package nethttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theovassiliou/base64url"
+
+	iid "github.com/theovassiliou/instanceidentification"
+)
+
+// roundTripFunc stands in for the called service
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// callee responds with the given X-Instance-Id header and reports the
+// received iid-request
+func callee(ciid string, received *string) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		*received = req.Header.Get(iid.XINSTANCEID)
+		w := httptest.NewRecorder()
+		if ciid != "" {
+			w.Header().Set(iid.XINSTANCEID, ciid)
+		}
+		return w.Result(), nil
+	}
+}
+
+func TestTransport(t *testing.T) {
+	const url = "https://api.example.com/v1/items"
+	expected := "?api.example.com/x/aHR0cHM6Ly9hcGkuZXhhbXBsZS5jb20vdjEvaXRlbXM%0s"
+	tests := []struct {
+		name         string
+		transport    Transport
+		mode         iid.RecordingMode
+		ciid         string
+		wantRequest  string
+		wantRecorded string
+	}{
+		{"confirmation", Transport{}, iid.ByConfirmation, "db/1.2%33s(storage/0.2%77s)", "empty", "db/1.2%33s(storage/0.2%77s)"},
+		{"confirmation without Ciid", Transport{}, iid.ByConfirmation, "", "empty", ""},
+		{"confirmation with invalid Ciid", Transport{}, iid.ByConfirmation, "db/1.2", "empty", ""},
+		{"expectation confirmed", Transport{}, iid.ByExpectation, "db/1.2%33s", "empty", "db/1.2%33s"},
+		{"expectation", Transport{}, iid.ByExpectation, "", "empty", expected},
+		{"expectation with invalid Ciid", Transport{}, iid.ByExpectation, "db/1.2", "empty", expected},
+		{
+			"custom expectation",
+			Transport{Expectation: func(*http.Request) iid.Miid { return iid.NewStdMiid("items/x%0s") }},
+			iid.ByExpectation, "", "empty", "?items/x%0s",
+		},
+		{
+			"key and options",
+			Transport{ClientConfig: ClientConfig{Request: iid.NewIRequestFromString("key=abc options=v")}},
+			iid.ByConfirmation, "db/1.2%33s", "key=abc options=v", "db/1.2%33s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			tt.transport.Base = callee(tt.ciid, &received)
+			tt.transport.ErrorLog = log.New(io.Discard, "", 0)
+			rec := iid.NewRecorder(iid.NewStdMiid("ourService/1.1%-1s"), time.Now()).SetMode(tt.mode)
+			req, _ := http.NewRequestWithContext(iid.WithRecorder(context.Background(), rec), http.MethodGet, url, nil)
+
+			if _, err := tt.transport.RoundTrip(req); err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			if received != tt.wantRequest {
+				t.Errorf("X-Instance-Id request = %v, want %v", received, tt.wantRequest)
+			}
+			if req.Header.Get(iid.XINSTANCEID) != "" {
+				t.Errorf("RoundTrip() modified the request")
+			}
+			got, gotExpected := "", false
+			if calls := rec.Calls(); len(calls) == 1 {
+				got, gotExpected = calls[0].String(), iid.IsExpected(calls[0])
+			} else if len(calls) > 1 {
+				t.Fatalf("recorded %v, want at most one Ciid", calls)
+			}
+			if got != tt.wantRecorded {
+				t.Errorf("recorded %v, want %v", got, tt.wantRecorded)
+			}
+			if wantExpected := tt.mode == iid.ByExpectation && tt.ciid != "db/1.2%33s"; gotExpected != wantExpected {
+				t.Errorf("recorded by expectation = %v, want %v", gotExpected, wantExpected)
+			}
+		})
+	}
+}
+
+func TestTransport_noRecorder(t *testing.T) {
+	received := "unset"
+	tr := &Transport{Base: callee("db/1.2%33s", &received)}
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if received != "" {
+		t.Errorf("X-Instance-Id request = %v, want none", received)
+	}
+}
+
+func TestTransport_error(t *testing.T) {
+	failure := errors.New("connection refused")
+	tr := &Transport{
+		Base: roundTripFunc(func(*http.Request) (*http.Response, error) { return nil, failure }),
+	}
+	rec := iid.NewRecorder(iid.NewStdMiid("ourService/1.1%-1s"), time.Now()).SetMode(iid.ByExpectation)
+	req, _ := http.NewRequestWithContext(iid.WithRecorder(context.Background(), rec), http.MethodGet, "http://db:5432/", nil)
+	if _, err := tr.RoundTrip(req); err != failure {
+		t.Errorf("RoundTrip() error = %v, want %v", err, failure)
+	}
+	if calls := rec.Calls(); len(calls) != 1 || calls[0].Miid().Sn() != "db" {
+		t.Errorf("recorded %v, want expected db", calls)
+	}
+}
+
+func TestTransport_errorLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		ciid    string
+		wantLog string
+	}{
+		{"valid", "db/1.2%33s", ""},
+		{"invalid", "db/1.2", "nethttp: recording api.example.com: instanceid: "},
+		{"recorded by expectation", "db/1.2%33s(?api/x%0s)", "nethttp: recording api.example.com: " + iid.ErrMixedModes.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			var buf bytes.Buffer
+			tr := &Transport{Base: callee(tt.ciid, &received), ClientConfig: ClientConfig{ErrorLog: log.New(&buf, "", 0)}}
+			rec := iid.NewRecorder(iid.NewStdMiid("ourService/1.1%-1s"), time.Now())
+			req, _ := http.NewRequestWithContext(iid.WithRecorder(context.Background(), rec), http.MethodGet, "https://api.example.com/", nil)
+			if _, err := tr.RoundTrip(req); err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			if got := buf.String(); !strings.HasPrefix(got, tt.wantLog) || (tt.wantLog == "") != (got == "") {
+				t.Errorf("logged %q, want %q", got, tt.wantLog)
+			}
+			if got := len(rec.Calls()); (got == 1) != (tt.wantLog == "") {
+				t.Errorf("recorded %v Ciids, want the valid one only", got)
+			}
+		})
+	}
+}
+
+func TestTransport_endToEnd(t *testing.T) {
+	start := time.Now()
+	backend := httptest.NewServer(Middleware(Config{Miid: iid.NewStdMiid("backend/2.0%-1s"), StartTime: start})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer backend.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	frontend := Middleware(Config{Miid: iid.NewStdMiid("frontend/1.0%-1s"), StartTime: start})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, backend.URL, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(iid.XINSTANCEID, "empty")
+	w := httptest.NewRecorder()
+	frontend.ServeHTTP(w, req)
+
+	if got, want := w.Header().Get(iid.XINSTANCEID), "frontend/1.0%0s(backend/2.0%0s)"; got != want {
+		t.Errorf("X-Instance-Id = %v, want %v", got, want)
+	}
+}
+
+func TestTransport_signed(t *testing.T) {
+	start := time.Now()
+	backend := httptest.NewServer(Middleware(Config{
+		Miid:      iid.NewStdMiid("backend/2.0%-1s"),
+		StartTime: start,
+		Signer:    iid.HMACKey("backend-secret"),
+		KeyID:     "backend",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer backend.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	frontend := Middleware(Config{
+		Miid:      iid.NewStdMiid("frontend/1.0%-1s"),
+		StartTime: start,
+		Signer:    iid.HMACKey("frontend-secret"),
+		KeyID:     "frontend",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, backend.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(iid.XINSTANCEID, "empty")
+	w := httptest.NewRecorder()
+	frontend.ServeHTTP(w, req)
+
+	c := iid.NewStdCiid(w.Header().Get(iid.XINSTANCEID))
+	sigs, err := iid.ParseSignatures(w.Header().Get(iid.SignatureHeader))
+	if err != nil {
+		t.Fatalf("ParseSignatures() error = %v", err)
+	}
+	if len(sigs) != 2 || sigs[0].KeyID != "frontend" || sigs[1].KeyID != "backend" {
+		t.Errorf("Signatures = %v, want signed by frontend and backend", sigs)
+	}
+	keyring := iid.Keyring{
+		"frontend": {Sn: "frontend", Verifier: iid.HMACKey("frontend-secret")},
+		"backend":  {Sn: "backend", Verifier: iid.HMACKey("backend-secret")},
+	}
+	if err := iid.Verify(c, sigs, keyring); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestTransport_sealed(t *testing.T) {
+	sealKey := []byte("0123456789abcdef")
+	sealed, err := iid.Seal(iid.NewStdCiid("db/1.2/main-ab12%33s"), sealKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received string
+	tr := &Transport{
+		Base:         callee(sealed, &received),
+		ClientConfig: ClientConfig{Request: iid.NewIRequestFromString("key=caffee options=e"), SealKey: sealKey},
+	}
+	rec := iid.NewRecorder(iid.NewStdMiid("ourService/1.1%-1s"), time.Now())
+	req, _ := http.NewRequestWithContext(iid.WithRecorder(context.Background(), rec), http.MethodGet, "http://db/", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if calls := rec.Calls(); len(calls) != 1 || calls[0].String() != "db/1.2/main-ab12%33s" {
+		t.Errorf("recorded %v, want db/1.2/main-ab12%%33s", calls)
+	}
+}
+
+func TestExpectedMiid(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"plain", "https://api.example.com/v1/items", "https://api.example.com/v1/items"},
+		{"query and user info", "https://user:pw@api.example.com/v1/items?api_key=secret#top", "https://api.example.com/v1/items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			want := iid.NewExternalMiid("api.example.com", tt.want).String()
+			if got := ExpectedMiid(req).String(); got != want {
+				t.Errorf("ExpectedMiid() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestTransport_longURL checks that the Ciid recorded by expectation for a
+// long url passes the limits of the caller's caller
+func TestTransport_longURL(t *testing.T) {
+	url := "https://api.example.com/v1/" + strings.Repeat("items/", 30) + "?api_key=" + strings.Repeat("s", 100)
+	var received string
+	tr := &Transport{Base: callee("", &received)}
+	rec := iid.NewRecorder(iid.NewStdMiid("ourService/1.1%-1s"), time.Now()).SetMode(iid.ByExpectation)
+	req, _ := http.NewRequestWithContext(iid.WithRecorder(context.Background(), rec), http.MethodGet, url, nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	header := rec.Ciid().String()
+	c, err := iid.ParseCiidWithOptions(header, iid.DefaultParserOptions)
+	if err != nil {
+		t.Fatalf("ParseCiidWithOptions(%v) error = %v", header, err)
+	}
+	va, _ := base64url.Decode(c.Ciids()[0].Miid().Va())
+	if strings.Contains(string(va), "api_key") {
+		t.Errorf("Va = %s, want no query", va)
+	}
+}
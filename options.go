@@ -0,0 +1,89 @@
+package instanceid
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The iid-request options known to this package. An option is a single
+// letter, e.g. "options=sv" requests OptionShallow and OptionVa.
+var (
+	// OptionShallow requests the Miid of the service only
+	OptionShallow = IOption{commandName: "s"}
+
+	// OptionDeep requests the complete call graph
+	OptionDeep = IOption{commandName: "d"}
+
+	// OptionContacted requests the contacted services instead of the called
+	// services, see Contacted
+	OptionContacted = IOption{commandName: "c"}
+
+	// OptionVa requests the Va of every Miid, if the DisclosurePolicy
+	// discloses Va on request only
+	OptionVa = IOption{commandName: "v"}
+
+	// OptionSealed requests the Ciid sealed with the key of the
+	// iid-request, see Seal
+	OptionSealed = IOption{commandName: "e"}
+)
+
+var (
+	optionsMu sync.RWMutex
+	options   = map[string]string{
+		OptionShallow.Command():   "shallow: disclose the Miid of the service only",
+		OptionDeep.Command():      "deep: disclose the complete call graph",
+		OptionContacted.Command(): "contacted: disclose the contacted instead of the called services",
+		OptionVa.Command():        "Va: disclose the Va of every Miid",
+		OptionSealed.Command():    "encrypted: seal the Ciid with the key of the iid-request",
+	}
+)
+
+// RegisterOption registers an application specific iid-request option with
+// a description and returns it. command must be a single letter not
+// registered yet.
+func RegisterOption(command, description string) (IOption, error) {
+	r, size := utf8.DecodeRuneInString(command)
+	if size == 0 || size != len(command) || !unicode.IsLetter(r) {
+		return IOption{}, errors.New("instanceid: option " + command + " is not a single letter")
+	}
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	if _, ok := options[command]; ok {
+		return IOption{}, errors.New("instanceid: option " + command + " already registered")
+	}
+	options[command] = description
+	return IOption{commandName: command}, nil
+}
+
+// LookupOption returns the description of a registered iid-request option
+func LookupOption(command string) (description string, ok bool) {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+	description, ok = options[command]
+	return description, ok
+}
+
+// RegisteredOptions returns the commands of all registered iid-request
+// options, sorted
+func RegisteredOptions() []string {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+	commands := make([]string, 0, len(options))
+	for c := range options {
+		commands = append(commands, c)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// HasOption returns true if r carries the option o
+func HasOption(r IidRequest, o Option) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.Options()[o.Command()]
+	return ok
+}
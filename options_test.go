@@ -0,0 +1,34 @@
+package instanceid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisterOption(t *testing.T) {
+	if got, want := RegisteredOptions(), []string{"c", "d", "e", "s", "v"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("RegisteredOptions() = %v, want %v", got, want)
+	}
+
+	for _, command := range []string{"", "xy", "1", "s"} {
+		if _, err := RegisterOption(command, "invalid"); err == nil {
+			t.Errorf("RegisterOption(%q) error = nil, want error", command)
+		}
+	}
+
+	o, err := RegisterOption("x", "application specific")
+	if err != nil {
+		t.Fatalf("RegisterOption() error = %v", err)
+	}
+	defer func() {
+		optionsMu.Lock()
+		delete(options, "x")
+		optionsMu.Unlock()
+	}()
+	if d, ok := LookupOption("x"); !ok || d != "application specific" {
+		t.Errorf("LookupOption() = %v, %v, want application specific", d, ok)
+	}
+	if !HasOption(NewIRequestFromString("empty options=xv"), o) {
+		t.Errorf("HasOption() = false, want true")
+	}
+}
@@ -0,0 +1,276 @@
+package instanceid
+
+import (
+	"strconv"
+	"strings"
+)
+
+// QueryError describes why a query expression could not be compiled
+type QueryError struct {
+	// Expr is the complete query expression
+	Expr string
+
+	// Offset is the byte offset into Expr where the error has been detected
+	Offset int
+
+	// Reason describes the error
+	Reason string
+}
+
+// Error returns the textual representation of the query error
+func (e *QueryError) Error() string {
+	return "instanceid: invalid query " + strconv.Quote(e.Expr) + " at offset " +
+		strconv.Itoa(e.Offset) + ": " + e.Reason
+}
+
+// queryStep selects Ciids by service name and predicates, either among the
+// calls of the current Ciids or among all their descendants
+type queryStep struct {
+	descendant bool
+	name       string
+	predicates []queryPredicate
+}
+
+// queryPredicate compares a field of a Miid with a value
+type queryPredicate struct {
+	field string
+	op    string
+	value string
+	t     int
+}
+
+// Query returns the Ciids of the call graph of c selected by expr, in
+// pre-order and without duplicates. An expression is a sequence of steps
+// separated by '/' selecting calls of the Ciids selected so far, or by "//"
+// selecting any Ciid called directly or indirectly. The first step selects
+// c, or any Ciid if expr starts with "//". A step is a service name or '*'
+// for any service, followed by any number of predicates in brackets
+// comparing sn, vn, va or t with '=' or "!=", or t with '<', "<=", '>' or
+// ">=". Values may be quoted with '"'. Examples:
+//
+//	gateway/*/database//storageService
+//	//database[vn=1.2]
+//	gateway//*[t<60][va!=""]
+//
+// Fields are compared exactly, unlike with Contains.
+func Query(c Ciid, expr string) ([]Ciid, error) {
+	steps, err := compileQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	g := newQueryGraph(c)
+	selected := make([]bool, len(g.nodes))
+	for i, step := range steps {
+		next := make([]bool, len(g.nodes))
+		candidate := func(n int) {
+			if step.matches(g.nodes[n].Miid()) {
+				next[n] = true
+			}
+		}
+		switch {
+		case i == 0 && step.descendant:
+			for n := range g.nodes {
+				candidate(n)
+			}
+		case i == 0:
+			candidate(0)
+		default:
+			for n, ok := range selected {
+				if !ok {
+					continue
+				}
+				if step.descendant {
+					for d := n + 1; d < g.end[n]; d++ {
+						candidate(d)
+					}
+				} else {
+					for _, d := range g.calls[n] {
+						candidate(d)
+					}
+				}
+			}
+		}
+		selected = next
+	}
+
+	var found []Ciid
+	for n, ok := range selected {
+		if ok {
+			found = append(found, g.nodes[n])
+		}
+	}
+	return found, nil
+}
+
+// queryGraph numbers the Ciids of a call graph in pre-order. The
+// descendants of node n are the nodes n+1 up to end[n]-1.
+type queryGraph struct {
+	nodes []Ciid
+	calls [][]int
+	end   []int
+}
+
+func newQueryGraph(c Ciid) *queryGraph {
+	g := new(queryGraph)
+	g.add(c)
+	return g
+}
+
+func (g *queryGraph) add(c Ciid) int {
+	n := len(g.nodes)
+	g.nodes = append(g.nodes, c)
+	g.calls = append(g.calls, nil)
+	g.end = append(g.end, 0)
+	for _, call := range c.Ciids() {
+		g.calls[n] = append(g.calls[n], g.add(call))
+	}
+	g.end[n] = len(g.nodes)
+	return n
+}
+
+func (s queryStep) matches(m Miid) bool {
+	if m == nil || (s.name != "*" && s.name != m.Sn()) {
+		return false
+	}
+	for _, p := range s.predicates {
+		if !p.matches(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p queryPredicate) matches(m Miid) bool {
+	if p.field == "t" {
+		switch p.op {
+		case "=":
+			return m.T() == p.t
+		case "!=":
+			return m.T() != p.t
+		case "<":
+			return m.T() < p.t
+		case "<=":
+			return m.T() <= p.t
+		case ">":
+			return m.T() > p.t
+		}
+		return m.T() >= p.t
+	}
+
+	var v string
+	switch p.field {
+	case "sn":
+		v = m.Sn()
+	case "vn":
+		v = m.Vn()
+	case "va":
+		v = m.Va()
+	}
+	return (v == p.value) == (p.op == "=")
+}
+
+// queryCompiler turns a query expression into steps
+type queryCompiler struct {
+	expr string
+	pos  int
+}
+
+func compileQuery(expr string) ([]queryStep, error) {
+	q := &queryCompiler{expr: expr}
+	if expr == "" {
+		return nil, q.fail("empty query")
+	}
+
+	var steps []queryStep
+	for first := true; first || q.pos < len(q.expr); first = false {
+		var step queryStep
+		switch {
+		case strings.HasPrefix(q.expr[q.pos:], "//"):
+			step.descendant = true
+			q.pos += 2
+		case !first && q.expr[q.pos] == '/':
+			q.pos++
+		case !first:
+			return nil, q.fail("expected '/'")
+		}
+
+		start := q.pos
+		for q.pos < len(q.expr) && q.expr[q.pos] != '/' && q.expr[q.pos] != '[' {
+			q.pos++
+		}
+		if step.name = q.expr[start:q.pos]; step.name == "" {
+			return nil, q.fail("expected service name or '*'")
+		}
+
+		for q.pos < len(q.expr) && q.expr[q.pos] == '[' {
+			p, err := q.predicate()
+			if err != nil {
+				return nil, err
+			}
+			step.predicates = append(step.predicates, p)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// predicate compiles "[" field op value "]"
+func (q *queryCompiler) predicate() (p queryPredicate, err error) {
+	q.pos++
+	start := q.pos
+	for q.pos < len(q.expr) && strings.IndexByte("=!<>]", q.expr[q.pos]) < 0 {
+		q.pos++
+	}
+	switch p.field = strings.TrimSpace(q.expr[start:q.pos]); p.field {
+	case "sn", "vn", "va", "t":
+	default:
+		q.pos = start
+		return p, q.fail("expected sn, vn, va or t")
+	}
+
+	for _, op := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(q.expr[q.pos:], op) {
+			p.op = op
+			break
+		}
+	}
+	if p.op == "" {
+		return p, q.fail("expected comparison operator")
+	}
+	if p.field != "t" && p.op != "=" && p.op != "!=" {
+		return p, q.fail("operator " + p.op + " only applies to t")
+	}
+	q.pos += len(p.op)
+
+	start = q.pos
+	if q.pos < len(q.expr) && q.expr[q.pos] == '"' {
+		end := strings.IndexByte(q.expr[q.pos+1:], '"')
+		if end < 0 {
+			return p, q.fail("unterminated quoted value")
+		}
+		p.value = q.expr[q.pos+1 : q.pos+1+end]
+		q.pos += end + 2
+	} else {
+		for q.pos < len(q.expr) && q.expr[q.pos] != ']' {
+			q.pos++
+		}
+		p.value = strings.TrimSpace(q.expr[start:q.pos])
+	}
+
+	if p.field == "t" {
+		if p.t, err = strconv.Atoi(p.value); err != nil {
+			q.pos = start
+			return p, q.fail("epoch is not an integer")
+		}
+	}
+	if q.pos == len(q.expr) || q.expr[q.pos] != ']' {
+		return p, q.fail("expected ']'")
+	}
+	q.pos++
+	return p, nil
+}
+
+func (q *queryCompiler) fail(reason string) *QueryError {
+	return &QueryError{Expr: q.expr, Offset: q.pos, Reason: reason}
+}
@@ -0,0 +1,97 @@
+package instanceid
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const queryCiid = "gateway/1.1/eu%1s(auth/2.0%2s(database/1.2%3s(storageService/0.2%4s))+orders/1.0%5s(database/1.3/b%6s(cache/1%7s(storageService/0.3%8s)))+database/1.2%9s)"
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want []string
+	}{
+		{"root", "gateway", []string{"gateway/1.1/eu%1s"}},
+		{"root mismatch", "auth", nil},
+		{"any root", "*", []string{"gateway/1.1/eu%1s"}},
+		{"direct calls", "gateway/*", []string{"auth/2.0%2s", "orders/1.0%5s", "database/1.2%9s"}},
+		{"named call", "gateway/database", []string{"database/1.2%9s"}},
+		{"path", "gateway/*/database/storageService", []string{"storageService/0.2%4s"}},
+		{"any depth", "gateway/*/database//storageService", []string{"storageService/0.2%4s", "storageService/0.3%8s"}},
+		{"anywhere", "//database", []string{"database/1.2%3s", "database/1.3/b%6s", "database/1.2%9s"}},
+		{"descendants only", "//storageService//*", nil},
+		{"no duplicates", "//*//storageService", []string{"storageService/0.2%4s", "storageService/0.3%8s"}},
+		{"vn", "//database[vn=1.2]", []string{"database/1.2%3s", "database/1.2%9s"}},
+		{"vn is exact", "//database[vn=1]", nil},
+		{"vn not equal", "//database[vn!=1.2]", []string{"database/1.3/b%6s"}},
+		{"va", "//*[va=b]", []string{"database/1.3/b%6s"}},
+		{"empty va", `gateway/*[va=""]`, []string{"auth/2.0%2s", "orders/1.0%5s", "database/1.2%9s"}},
+		{"quoted value", `//*[va="eu"]`, []string{"gateway/1.1/eu%1s"}},
+		{"sn", "//*[sn=cache]", []string{"cache/1%7s"}},
+		{"t less", "//*[t<3]", []string{"gateway/1.1/eu%1s", "auth/2.0%2s"}},
+		{"t range", "//*[t>=3][t<=4]", []string{"database/1.2%3s", "storageService/0.2%4s"}},
+		{"t equal", "//*[t=9]", []string{"database/1.2%9s"}},
+		{"spaces", "//*[ t > 7 ]", []string{"storageService/0.3%8s", "database/1.2%9s"}},
+		{"predicate on path", "gateway/orders[t=5]//storageService", []string{"storageService/0.3%8s"}},
+	}
+	c := NewStdCiid(queryCiid)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := Query(c, tt.expr)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			var got []string
+			for _, f := range found {
+				got = append(got, f.Miid().String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery_calls(t *testing.T) {
+	found, err := Query(NewStdCiid(queryCiid), "gateway/orders")
+	if err != nil || len(found) != 1 {
+		t.Fatalf("Query() = %v, %v", found, err)
+	}
+	if got, want := found[0].String(), "orders/1.0%5s(database/1.3/b%6s(cache/1%7s(storageService/0.3%8s)))"; got != want {
+		t.Errorf("Query() = %v, want %v", got, want)
+	}
+}
+
+func TestQuery_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expr       string
+		wantOffset int
+	}{
+		{"empty", "", 0},
+		{"trailing slash", "gateway/", 8},
+		{"empty step", "gateway///db", 9},
+		{"unknown field", "db[version=1]", 3},
+		{"missing operator", "db[vn]", 5},
+		{"ordering on vn", "db[vn<1]", 5},
+		{"non-numeric t", "db[t=x]", 5},
+		{"unterminated predicate", "db[vn=1", 7},
+		{"unterminated quote", `db[vn="1]`, 6},
+		{"text after predicate", "db[vn=1]x", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Query(NewStdCiid(queryCiid), tt.expr)
+			var qErr *QueryError
+			if !errors.As(err, &qErr) {
+				t.Fatalf("Query() error = %v, want *QueryError", err)
+			}
+			if qErr.Offset != tt.wantOffset || qErr.Expr != tt.expr {
+				t.Errorf("Query() error = %v, want offset %v", err, tt.wantOffset)
+			}
+		})
+	}
+}
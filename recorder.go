@@ -0,0 +1,252 @@
+package instanceid
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RecordingMode defines how a recording service records the services it
+// calls, see doc/INTRODUCTION.md
+type RecordingMode int
+
+const (
+	// ByConfirmation records a called service if, and only if, it responds
+	// with a valid Ciid
+	ByConfirmation RecordingMode = iota
+
+	// ByExpectation records every called service with the information known
+	// to the caller, and replaces it with the Ciid the service responds with
+	ByExpectation
+)
+
+// String returns the name of the recording mode
+func (m RecordingMode) String() string {
+	switch m {
+	case ByConfirmation:
+		return "by confirmation"
+	case ByExpectation:
+		return "by expectation"
+	}
+	return "RecordingMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// ErrMixedModes is returned when recording by expectation and by confirmation
+// would be mixed in one call graph
+var ErrMixedModes = errors.New("instanceid: recording by expectation and by confirmation mixed")
+
+// ExpectedMarker precedes the Miid of a Ciid recorded by expectation in its
+// textual representation, e.g. "ourService/1.1%0s(?db/x%0s+mon/1.1%4s)". A
+// '?' is escaped within <sN>, so no Ciid is reinterpreted.
+const ExpectedMarker = "?"
+
+// IsExpected returns true if c has been recorded by expectation, i.e. c
+// implements
+//
+//	Expected() bool
+//
+// returning true. Otherwise c has been recorded by confirmation.
+func IsExpected(c Ciid) bool {
+	e, ok := c.(interface{ Expected() bool })
+	return ok && e.Expected()
+}
+
+// Recorder collects the Ciids of the services called while handling a single
+// request. Record may be called concurrently, e.g. from goroutines fanning
+// out to several services. A nil *Recorder records nothing.
+type Recorder struct {
+	miid      Miid
+	startTime time.Time
+
+	mu         sync.Mutex
+	mode       RecordingMode
+	semantics  CallSemantics
+	calls      Stack
+	signatures map[string]Signatures
+}
+
+// NewRecorder creates a Recorder for a request handled by the service
+// identified by miid and started at startTime, recording by confirmation.
+// miid is never modified.
+func NewRecorder(miid Miid, startTime time.Time) *Recorder {
+	return &Recorder{miid: miid, startTime: startTime}
+}
+
+// SetMode sets the recording mode. Chainable
+func (r *Recorder) SetMode(mode RecordingMode) *Recorder {
+	if r == nil {
+		return r
+	}
+	r.mu.Lock()
+	r.mode = mode
+	r.mu.Unlock()
+	return r
+}
+
+// SetSemantics sets the call semantics of the Ciid returned by Ciid. Chainable
+func (r *Recorder) SetSemantics(s CallSemantics) *Recorder {
+	if r == nil {
+		return r
+	}
+	r.mu.Lock()
+	r.semantics = s
+	r.mu.Unlock()
+	return r
+}
+
+// Mode returns the recording mode
+func (r *Recorder) Mode() RecordingMode {
+	if r == nil {
+		return ByConfirmation
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mode
+}
+
+// Record adds the Ciid returned by a called service, i.e. by confirmation.
+// Nil Ciids are ignored. Recording by confirmation a Ciid containing Ciids
+// recorded by expectation fails with ErrMixedModes.
+func (r *Recorder) Record(c Ciid) error {
+	if r == nil || c == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == ByConfirmation && containsExpected(c) {
+		return ErrMixedModes
+	}
+	r.calls = append(r.calls, c)
+	return nil
+}
+
+// RecordOnce records c like Record unless an equal Ciid has been recorded,
+// see Equal. It reports whether c has been recorded.
+func (r *Recorder) RecordOnce(c Ciid) (bool, error) {
+	if r == nil || c == nil {
+		return false, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, call := range r.calls {
+		if Equal(call, c) {
+			return false, nil
+		}
+	}
+	if r.mode == ByConfirmation && containsExpected(c) {
+		return false, ErrMixedModes
+	}
+	r.calls = append(r.calls, c)
+	return true, nil
+}
+
+// Expect adds a service about to be called, identified by m, by expectation
+// and returns its position for Confirm. Fails with ErrMixedModes when
+// recording by confirmation.
+func (r *Recorder) Expect(m Miid) (int, error) {
+	if r == nil {
+		return -1, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode != ByExpectation {
+		return -1, ErrMixedModes
+	}
+	r.calls = append(r.calls, NewCiidBuilder(m).Build().WithExpected(true))
+	return len(r.calls) - 1, nil
+}
+
+// Confirm replaces the Ciid added by Expect at position i with the Ciid c
+// returned by the called service, keeping the order of the calls
+func (r *Recorder) Confirm(i int, c Ciid) error {
+	if r == nil || c == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i < 0 || i >= len(r.calls) || !IsExpected(r.calls[i]) {
+		return errors.New("instanceid: no expected Ciid at position " + strconv.Itoa(i))
+	}
+	r.calls[i] = c
+	return nil
+}
+
+// AddSignatures adds the Signatures the called service has sent for c, see
+// Sign
+func (r *Recorder) AddSignatures(c Ciid, sigs Signatures) {
+	if r == nil || c == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.signatures == nil {
+		r.signatures = map[string]Signatures{}
+	}
+	r.signatures[c.String()] = sigs
+}
+
+// Signatures returns a copy of the Signatures added so far, by the textual
+// representation of the Ciid they sign
+func (r *Recorder) Signatures() map[string]Signatures {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sigs := make(map[string]Signatures, len(r.signatures))
+	for c, s := range r.signatures {
+		sigs[c] = s
+	}
+	return sigs
+}
+
+// Calls returns a copy of the Ciids recorded so far, in the order recorded
+func (r *Recorder) Calls() Stack {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append(Stack(nil), r.calls...)
+}
+
+// Ciid returns a new Ciid of the service with its epoch set to now and the
+// Ciids recorded so far as calls. With Contacted semantics the calls are
+// merged and sorted, see Canonical. A nil *Recorder returns nil.
+func (r *Recorder) Ciid() Ciid {
+	if r == nil {
+		return nil
+	}
+	m := &StdMiid{sn: r.miid.Sn(), vn: r.miid.Vn(), va: r.miid.Va()}
+	m.SetEpoch(r.startTime)
+	c := &StdCiid{miid: m, ciids: r.Calls()}
+
+	r.mu.Lock()
+	s := r.semantics
+	r.mu.Unlock()
+	if s == Contacted {
+		return Canonical(c, Contacted)
+	}
+	return c
+}
+
+// containsExpected returns true if any Ciid of the call graph of c has been
+// recorded by expectation
+func containsExpected(c Ciid) bool {
+	return Find(c, IsExpected) != nil
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a copy of ctx carrying r
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// RecorderFrom returns the Recorder carried by ctx, or nil if there is none
+func RecorderFrom(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
@@ -0,0 +1,197 @@
+package instanceid
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	template := NewStdCiid("ourService/1.1/dev%-1s")
+	r := NewRecorder(template.Miid(), time.Now().Add(-5*time.Second))
+	r.Record(NewStdCiid("database/1.2%33s(storageService/0.2%77s)"))
+	r.Record(nil)
+	r.Record(NewStdCiid("monitoring/1.1%22242s"))
+
+	want := "ourService/1.1/dev%5s(database/1.2%33s(storageService/0.2%77s)+monitoring/1.1%22242s)"
+	if got := r.Ciid().String(); got != want {
+		t.Errorf("Recorder.Ciid() = %v, want %v", got, want)
+	}
+	if got := template.String(); got != "ourService/1.1/dev%-1s" {
+		t.Errorf("template = %v, want unmodified", got)
+	}
+}
+
+func TestRecorder_concurrent(t *testing.T) {
+	r := NewRecorder(NewStdMiid("ourService/1.1%-1s"), time.Now())
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			RecorderFrom(WithRecorder(context.Background(), r)).Record(NewStdCiid("svc" + strconv.Itoa(i) + "/1%1s"))
+			r.Ciid()
+		}(i)
+	}
+	wg.Wait()
+
+	var got []string
+	for _, c := range r.Calls() {
+		got = append(got, c.Miid().Sn())
+	}
+	sort.Strings(got)
+	if len(got) != 50 || got[0] != "svc0" || got[49] != "svc9" {
+		t.Errorf("Recorder.Calls() = %v, want svc0 to svc49", got)
+	}
+}
+
+func TestRecorder_RecordOnce(t *testing.T) {
+	r := NewRecorder(NewStdMiid("ourService/1.1%-1s"), time.Now())
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.RecordOnce(NewStdCiid("db/1.2%" + strconv.Itoa(i%2) + "s"))
+		}(i)
+	}
+	wg.Wait()
+	if ok, err := r.RecordOnce(NewStdCiid("db/1.2%1s")); ok || err != nil {
+		t.Errorf("RecordOnce() = %v, %v for a recorded Ciid, want false, nil", ok, err)
+	}
+	if ok, err := r.RecordOnce(NewStdCiid("db/1.3%1s")); !ok || err != nil {
+		t.Errorf("RecordOnce() = %v, %v, want true, nil", ok, err)
+	}
+	if got := len(r.Calls()); got != 3 {
+		t.Errorf("len(Recorder.Calls()) = %v, want 3", got)
+	}
+}
+
+func TestRecorder_nil(t *testing.T) {
+	var r *Recorder
+	if got := r.SetMode(ByExpectation).SetSemantics(Contacted); got != nil {
+		t.Errorf("SetMode().SetSemantics() = %v, want nil", got)
+	}
+	if got := r.Mode(); got != ByConfirmation {
+		t.Errorf("Mode() = %v, want %v", got, ByConfirmation)
+	}
+	if err := r.Record(NewStdCiid("a/1%1s")); err != nil {
+		t.Errorf("Record() = %v, want nil", err)
+	}
+	if ok, err := r.RecordOnce(NewStdCiid("a/1%1s")); ok || err != nil {
+		t.Errorf("RecordOnce() = %v, %v, want false, nil", ok, err)
+	}
+	if i, err := r.Expect(NewStdMiid("a/1%1s")); i != -1 || err != nil {
+		t.Errorf("Expect() = %v, %v, want -1, nil", i, err)
+	}
+	if err := r.Confirm(0, NewStdCiid("a/1%1s")); err != nil {
+		t.Errorf("Confirm() = %v, want nil", err)
+	}
+	r.AddSignatures(NewStdCiid("a/1%1s"), Signatures{{KeyID: "k"}})
+	if got := r.Signatures(); got != nil {
+		t.Errorf("Signatures() = %v, want nil", got)
+	}
+	if got := r.Calls(); got != nil {
+		t.Errorf("Calls() = %v, want nil", got)
+	}
+	if got := r.Ciid(); got != nil {
+		t.Errorf("Ciid() = %v, want nil", got)
+	}
+}
+
+func TestRecorderFrom(t *testing.T) {
+	if r := RecorderFrom(context.Background()); r != nil {
+		t.Errorf("RecorderFrom() = %v, want nil", r)
+	}
+	// recording without a recorder is a no-op
+	RecorderFrom(context.Background()).Record(NewStdCiid("a/1%1s"))
+
+	r := NewRecorder(NewStdMiid("a/1%1s"), time.Now())
+	if got := RecorderFrom(WithRecorder(context.Background(), r)); got != r {
+		t.Errorf("RecorderFrom() = %v, want %v", got, r)
+	}
+}
+
+func TestRecorder_modes(t *testing.T) {
+	r := NewRecorder(NewStdMiid("ourService/1.1%-1s"), time.Now())
+	if _, err := r.Expect(NewExternalMiid("api.example.com", "")); err != ErrMixedModes {
+		t.Errorf("Expect() error = %v, want %v", err, ErrMixedModes)
+	}
+
+	r.SetMode(ByExpectation)
+	db, _ := r.Expect(NewExternalMiid("db", ""))
+	api, _ := r.Expect(NewExternalMiid("api.example.com", ""))
+	if err := r.Record(NewStdCiid("mon/1.1%4s")); err != nil {
+		t.Errorf("Record() error = %v", err)
+	}
+	// the service called last responds first
+	if err := r.Confirm(api, NewStdCiid("api/2.0%5s")); err != nil {
+		t.Errorf("Confirm() error = %v", err)
+	}
+	if err := r.Confirm(api, NewStdCiid("api/2.0%5s")); err == nil {
+		t.Errorf("Confirm() twice error = nil, want error")
+	}
+	if err := r.Confirm(7, NewStdCiid("api/2.0%5s")); err == nil {
+		t.Errorf("Confirm() out of range error = nil, want error")
+	}
+
+	c := r.Ciid()
+	if got, want := c.String(), "ourService/1.1%0s(?db/x%0s+api/2.0%5s+mon/1.1%4s)"; got != want {
+		t.Errorf("Recorder.Ciid() = %v, want %v", got, want)
+	}
+	var got []bool
+	for _, call := range c.Ciids() {
+		got = append(got, IsExpected(call))
+	}
+	if want := []bool{true, false, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IsExpected() = %v, want %v", got, want)
+	}
+	if db != 0 {
+		t.Errorf("Expect() = %v, want 0", db)
+	}
+
+	// a graph recorded by expectation must not be part of one recorded by
+	// confirmation, also when received in its textual representation
+	r2 := NewRecorder(NewStdMiid("frontend/1%-1s"), time.Now())
+	if err := r2.Record(c); err != ErrMixedModes {
+		t.Errorf("Record() error = %v, want %v", err, ErrMixedModes)
+	}
+	if err := r2.Record(NewStdCiid(c.String())); err != ErrMixedModes {
+		t.Errorf("Record(%v) error = %v, want %v", c, err, ErrMixedModes)
+	}
+	if err := r2.SetMode(ByExpectation).Record(c); err != nil {
+		t.Errorf("Record() error = %v, want nil", err)
+	}
+}
+
+func TestRecorder_expectedOutput(t *testing.T) {
+	r := NewRecorder(NewStdMiid("ourService/1.1%-1s"), time.Now()).SetMode(ByExpectation)
+	r.Expect(NewExternalMiid("db", ""))
+	r.Record(NewStdCiid("mon/1.1%4s"))
+	c := r.Ciid().(*StdCiid)
+
+	js, _ := json.Marshal(c)
+	if got, want := string(js), `{"sn":"ourService","vn":"1.1","t":0,"calls":[{"sn":"db","vn":"x","t":0,"expected":true},{"sn":"mon","vn":"1.1","t":4}]}`; got != want {
+		t.Errorf("json.Marshal() = %v, want %v", got, want)
+	}
+	var back StdCiid
+	if err := json.Unmarshal(js, &back); err != nil || !IsExpected(back.Ciids()[0]) || IsExpected(back.Ciids()[1]) {
+		t.Errorf("json.Unmarshal() = %v, %v, want first call expected", back, err)
+	}
+
+	parsed, err := ParseCiid(c.String())
+	if err != nil || !IsExpected(parsed.Ciids()[0]) || IsExpected(parsed.Ciids()[1]) || parsed.String() != c.String() {
+		t.Errorf("ParseCiid(%v) = %v, %v, want first call expected", c, parsed, err)
+	}
+
+	tree := c.TreePrint()
+	if !strings.Contains(tree, "[0s, expected]  db/x") || strings.Contains(tree, "[4s, expected]") {
+		t.Errorf("TreePrint() = %v, want db marked as expected", tree)
+	}
+}
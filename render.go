@@ -0,0 +1,164 @@
+package instanceid
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RenderOptions configures RenderDOT, RenderMermaid and RenderPlantUML
+type RenderOptions struct {
+	// Ordered labels the edges of a Ciid with the position of the call, for
+	// Ciids reporting called services. The calls of Ciids with Contacted
+	// semantics are not labeled, their order has no meaning.
+	Ordered bool
+
+	// Collapse renders all occurrences of a service with the same Sn, Vn and
+	// Va as a single node. The node shows the epoch of the first occurrence.
+	Collapse bool
+}
+
+// graphNode is a service in a rendered call graph
+type graphNode struct {
+	index int
+	id    string
+	label string
+	epoch string
+}
+
+// graphEdge is a call in a rendered call graph
+type graphEdge struct {
+	from, to *graphNode
+	order    []string
+}
+
+// callGraph is the renderer independent form of a Ciid
+type callGraph struct {
+	nodes []*graphNode
+	edges []*graphEdge
+	opts  RenderOptions
+	known map[string]*graphNode
+	calls map[[2]string]*graphEdge
+}
+
+func newCallGraph(c Ciid, opts RenderOptions) *callGraph {
+	g := &callGraph{
+		opts:  opts,
+		known: map[string]*graphNode{},
+		calls: map[[2]string]*graphEdge{},
+	}
+	g.visit(c)
+
+	// list the calls of a service in the order of the services
+	sort.SliceStable(g.edges, func(i, j int) bool {
+		return g.edges[i].from.index < g.edges[j].from.index
+	})
+	return g
+}
+
+// visit adds c and its calls to the graph and returns the node representing c
+func (g *callGraph) visit(c Ciid) *graphNode {
+	m := c.Miid()
+	label, key, epoch := "?", "", ""
+	if m != nil {
+		label = m.Sn() + "/" + m.Vn()
+		if m.Va() != "" {
+			label += "/" + m.Va()
+		}
+		// the escaped form is unambiguous, e.g. for a Sn containing '/'
+		key = FreezeMiid(m).WithT(0).String()
+		epoch = strconv.Itoa(m.T()) + "s"
+	}
+
+	n, ok := g.known[key]
+	if !ok || !g.opts.Collapse || m == nil {
+		n = &graphNode{
+			index: len(g.nodes),
+			id:    "n" + strconv.Itoa(len(g.nodes)),
+			label: label,
+			epoch: epoch,
+		}
+		g.nodes = append(g.nodes, n)
+		if m != nil {
+			g.known[key] = n
+		}
+	}
+
+	for i, call := range c.Ciids() {
+		to := g.visit(call)
+		key := [2]string{n.id, to.id}
+		e, ok := g.calls[key]
+		if !ok {
+			e = &graphEdge{from: n, to: to}
+			g.edges = append(g.edges, e)
+			g.calls[key] = e
+		}
+		if g.opts.Ordered && SemanticsOf(c) != Contacted {
+			e.order = append(e.order, strconv.Itoa(i+1))
+		}
+	}
+	return n
+}
+
+// RenderDOT renders the call graph of c in the Graphviz DOT language
+func RenderDOT(c Ciid, opts RenderOptions) string {
+	g := newCallGraph(c, opts)
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	sB := strings.Builder{}
+	sB.WriteString("digraph ciid {\n")
+	sB.WriteString("\tnode [shape=box];\n")
+	for _, n := range g.nodes {
+		sB.WriteString("\t" + n.id + ` [label="` + quote.Replace(n.label) + `\n` + n.epoch + `"];` + "\n")
+	}
+	for _, e := range g.edges {
+		sB.WriteString("\t" + e.from.id + " -> " + e.to.id)
+		if len(e.order) > 0 {
+			sB.WriteString(` [label="` + strings.Join(e.order, ",") + `"]`)
+		}
+		sB.WriteString(";\n")
+	}
+	sB.WriteString("}\n")
+	return sB.String()
+}
+
+// RenderMermaid renders the call graph of c as Mermaid flowchart
+func RenderMermaid(c Ciid, opts RenderOptions) string {
+	g := newCallGraph(c, opts)
+	quote := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+
+	sB := strings.Builder{}
+	sB.WriteString("graph TD\n")
+	for _, n := range g.nodes {
+		sB.WriteString("\t" + n.id + `["` + quote.Replace(n.label) + "<br/>" + n.epoch + `"]` + "\n")
+	}
+	for _, e := range g.edges {
+		sB.WriteString("\t" + e.from.id + " -->")
+		if len(e.order) > 0 {
+			sB.WriteString("|" + strings.Join(e.order, ",") + "|")
+		}
+		sB.WriteString(" " + e.to.id + "\n")
+	}
+	return sB.String()
+}
+
+// RenderPlantUML renders the call graph of c as PlantUML diagram
+func RenderPlantUML(c Ciid, opts RenderOptions) string {
+	g := newCallGraph(c, opts)
+	quote := strings.NewReplacer(`\`, "<U+005C>", `"`, "<U+0022>")
+
+	sB := strings.Builder{}
+	sB.WriteString("@startuml\n")
+	for _, n := range g.nodes {
+		sB.WriteString(`rectangle "` + quote.Replace(n.label) + `\n` + n.epoch + `" as ` + n.id + "\n")
+	}
+	for _, e := range g.edges {
+		sB.WriteString(e.from.id + " --> " + e.to.id)
+		if len(e.order) > 0 {
+			sB.WriteString(" : " + strings.Join(e.order, ","))
+		}
+		sB.WriteString("\n")
+	}
+	sB.WriteString("@enduml\n")
+	return sB.String()
+}
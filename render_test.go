@@ -0,0 +1,151 @@
+package instanceid
+
+import "testing"
+
+const renderCiid = "gw/1.1/dev-a1%22s(db/1.2%33s(storage/0.2%77s)+mon/1.1%44s+db/1.2%33s)"
+
+func TestRenderDOT(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RenderOptions
+		want string
+	}{
+		{
+			"plain",
+			RenderOptions{},
+			`digraph ciid {
+	node [shape=box];
+	n0 [label="gw/1.1/dev-a1\n22s"];
+	n1 [label="db/1.2\n33s"];
+	n2 [label="storage/0.2\n77s"];
+	n3 [label="mon/1.1\n44s"];
+	n4 [label="db/1.2\n33s"];
+	n0 -> n1;
+	n0 -> n3;
+	n0 -> n4;
+	n1 -> n2;
+}
+`,
+		},
+		{
+			"ordered and collapsed",
+			RenderOptions{Ordered: true, Collapse: true},
+			`digraph ciid {
+	node [shape=box];
+	n0 [label="gw/1.1/dev-a1\n22s"];
+	n1 [label="db/1.2\n33s"];
+	n2 [label="storage/0.2\n77s"];
+	n3 [label="mon/1.1\n44s"];
+	n0 -> n1 [label="1,3"];
+	n0 -> n3 [label="2"];
+	n1 -> n2 [label="1"];
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderDOT(NewStdCiid(renderCiid), tt.opts); got != tt.want {
+				t.Errorf("RenderDOT() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderDOT_quoting(t *testing.T) {
+	want := `digraph ciid {
+	node [shape=box];
+	n0 [label="a/1/say \"hi\"\n1s"];
+}
+`
+	if got := RenderDOT(&StdCiid{miid: &StdMiid{sn: "a", vn: "1", va: `say "hi"`, t: 1}}, RenderOptions{}); got != want {
+		t.Errorf("RenderDOT() = %v, want %v", got, want)
+	}
+}
+
+func TestRenderDOT_contacted(t *testing.T) {
+	// the order of contacted services has no meaning
+	want := `digraph ciid {
+	node [shape=box];
+	n0 [label="gw/1.1/dev-a1\n22s"];
+	n1 [label="db/1.2\n33s"];
+	n2 [label="storage/0.2\n77s"];
+	n3 [label="mon/1.1\n44s"];
+	n0 -> n1;
+	n0 -> n3;
+	n1 -> n2;
+}
+`
+	if got := RenderDOT(Canonical(NewStdCiid(renderCiid), Contacted), RenderOptions{Ordered: true}); got != want {
+		t.Errorf("RenderDOT() = %v, want %v", got, want)
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	want := `graph TD
+	n0["gw/1.1/dev-a1<br/>22s"]
+	n1["db/1.2<br/>33s"]
+	n2["storage/0.2<br/>77s"]
+	n3["mon/1.1<br/>44s"]
+	n0 -->|1,3| n1
+	n0 -->|2| n3
+	n1 -->|1| n2
+`
+	if got := RenderMermaid(NewStdCiid(renderCiid), RenderOptions{Ordered: true, Collapse: true}); got != want {
+		t.Errorf("RenderMermaid() = %v, want %v", got, want)
+	}
+}
+
+func TestRenderPlantUML(t *testing.T) {
+	want := `@startuml
+rectangle "gw/1.1/dev-a1\n22s" as n0
+rectangle "db/1.2\n33s" as n1
+rectangle "storage/0.2\n77s" as n2
+rectangle "mon/1.1\n44s" as n3
+rectangle "db/1.2\n33s" as n4
+n0 --> n1
+n0 --> n3
+n0 --> n4
+n1 --> n2
+@enduml
+`
+	if got := RenderPlantUML(NewStdCiid(renderCiid), RenderOptions{}); got != want {
+		t.Errorf("RenderPlantUML() = %v, want %v", got, want)
+	}
+}
+
+func TestRenderPlantUML_quoting(t *testing.T) {
+	want := `@startuml
+rectangle "a/1/say <U+0022>hi<U+005C>n<U+0022>\n1s" as n0
+@enduml
+`
+	if got := RenderPlantUML(&StdCiid{miid: &StdMiid{sn: "a", vn: "1", va: `say "hi\n"`, t: 1}}, RenderOptions{}); got != want {
+		t.Errorf("RenderPlantUML() = %v, want %v", got, want)
+	}
+}
+
+func TestRenderDOT_collapseEscaped(t *testing.T) {
+	// a/b with vn c and a with vn b/c share the label a/b/c but not the Miid
+	c := &StdCiid{miid: &StdMiid{sn: "gw", vn: "1", t: 1}, ciids: Stack{
+		&StdCiid{miid: &StdMiid{sn: "a/b", vn: "c", t: 2}},
+		&StdCiid{miid: &StdMiid{sn: "a", vn: "b/c", t: 3}},
+		&StdCiid{},
+		&StdCiid{},
+	}}
+	want := `digraph ciid {
+	node [shape=box];
+	n0 [label="gw/1\n1s"];
+	n1 [label="a/b/c\n2s"];
+	n2 [label="a/b/c\n3s"];
+	n3 [label="?\n"];
+	n4 [label="?\n"];
+	n0 -> n1;
+	n0 -> n2;
+	n0 -> n3;
+	n0 -> n4;
+}
+`
+	if got := RenderDOT(c, RenderOptions{Collapse: true}); got != want {
+		t.Errorf("RenderDOT() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package instanceid
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/theovassiliou/base64url"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// sealVersion precedes the nonce of a sealed Ciid
+const sealVersion = 1
+
+// ErrNotSealed is returned by Open for values that have not been sealed with
+// the given key, or have been modified
+var ErrNotSealed = errors.New("instanceid: not a Ciid sealed with this key")
+
+// ErrShortSealKey is returned for seal keys shorter than MinSealKeySize
+var ErrShortSealKey = errors.New("instanceid: seal key too short")
+
+// MinSealKeySize is the minimal size of a seal key in bytes
+const MinSealKeySize = 16
+
+// deriveKey derives the XChaCha20-Poly1305 key from a seal key. Seal keys
+// are expected to be random, they are not stretched.
+func deriveKey(sealKey []byte) ([]byte, error) {
+	if len(sealKey) < MinSealKeySize {
+		return nil, ErrShortSealKey
+	}
+	key := make([]byte, chacha20poly1305.KeySize)
+	io.ReadFull(hkdf.New(sha256.New, sealKey, nil, []byte("instanceid seal")), key)
+	return key, nil
+}
+
+// Seal encrypts the textual representation of c with XChaCha20-Poly1305,
+// keyed by the seal key granted to the requester, see Grant.SealKey, and
+// returns it base64url encoded, so that only the requester can read it. The
+// seal key is a secret shared with the requester, never the key of the
+// iid-request, which is sent in plaintext. A sealed Ciid never contains '/'
+// or '%', unlike a Ciid.
+func Seal(c Ciid, sealKey []byte) (string, error) {
+	key, err := deriveKey(sealKey)
+	if err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(c.String())+aead.Overhead())
+	out[0] = sealVersion
+	if _, err := rand.Read(out[1:]); err != nil {
+		return "", err
+	}
+	out = aead.Seal(out, out[1:], []byte(c.String()), []byte(XINSTANCEID))
+	return base64url.Encode(out), nil
+}
+
+// Open decrypts a Ciid sealed by Seal with sealKey
+func Open(sealed string, sealKey []byte) (*StdCiid, error) {
+	key, err := deriveKey(sealKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64url.Decode(sealed)
+	if err != nil {
+		return nil, ErrNotSealed
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1+aead.NonceSize() || data[0] != sealVersion {
+		return nil, ErrNotSealed
+	}
+	plain, err := aead.Open(nil, data[1:1+aead.NonceSize()], data[1+aead.NonceSize():], []byte(XINSTANCEID))
+	if err != nil {
+		return nil, ErrNotSealed
+	}
+	return ParseCiidWithOptions(string(plain), DefaultParserOptions)
+}
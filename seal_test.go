@@ -0,0 +1,53 @@
+package instanceid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSeal(t *testing.T) {
+	const id = "gw/1.1/feature-branch-2345abcd%1s(db/1.2/main%2s)"
+	key := []byte("0123456789abcdef")
+	sealed, err := Seal(NewStdCiid(id), key)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if strings.ContainsAny(sealed, "/%+") || strings.Contains(sealed, "feature") {
+		t.Errorf("Seal() = %v, want opaque base64url", sealed)
+	}
+	if again, _ := Seal(NewStdCiid(id), key); again == sealed {
+		t.Errorf("Seal() twice = %v, want different nonces", again)
+	}
+
+	got, err := Open(sealed, key)
+	if err != nil || got.String() != id {
+		t.Errorf("Open() = %v, %v, want %v", got, err, id)
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)/2] ^= 1
+	for name, tt := range map[string]struct {
+		sealed string
+		key    []byte
+	}{
+		"wrong key":   {sealed, []byte("0123456789abcdeF")},
+		"tampered":    {string(tampered), key},
+		"truncated":   {sealed[:10], key},
+		"plain Ciid":  {id, key},
+		"not base64":  {"!!!", key},
+		"empty value": {"", key},
+	} {
+		if _, err := Open(tt.sealed, tt.key); err != ErrNotSealed {
+			t.Errorf("%v: Open() error = %v, want %v", name, err, ErrNotSealed)
+		}
+	}
+}
+
+func TestSeal_shortKey(t *testing.T) {
+	if _, err := Seal(NewStdCiid("gw/1%1s"), []byte("caffee")); err != ErrShortSealKey {
+		t.Errorf("Seal() error = %v, want %v", err, ErrShortSealKey)
+	}
+	if _, err := Open("AQ", nil); err != ErrShortSealKey {
+		t.Errorf("Open() error = %v, want %v", err, ErrShortSealKey)
+	}
+}
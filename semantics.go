@@ -0,0 +1,137 @@
+package instanceid
+
+import (
+	"sort"
+	"strconv"
+)
+
+// CallSemantics defines how the calls of a call graph are interpreted, see
+// doc/INTRODUCTION.md
+type CallSemantics int
+
+const (
+	// Called lists the called services in the order they have been called,
+	// including repeated calls of the same service
+	Called CallSemantics = iota
+
+	// Contacted enumerates the contacted services, each service once and in
+	// canonical order. Transmitted with the leading ContactedMarker.
+	Contacted
+)
+
+// ContactedMarker precedes the textual representation of a Ciid with
+// Contacted semantics, e.g. "+msA/1.1%22s(msB/2.2%33s+msC/1.0%44s)". Within
+// a call list it precedes a call whose semantics differ from the calling
+// Ciid's, e.g. "msA/1.1%22s(+msB/2.2%33s(msC/1.0%44s))" for a service
+// disclosing the contacted services; other calls inherit the semantics. A
+// leading '+' is invalid in the original grammar, so no Ciid is
+// reinterpreted.
+const ContactedMarker = "+"
+
+// String returns the name of the call semantics
+func (s CallSemantics) String() string {
+	switch s {
+	case Called:
+		return "called"
+	case Contacted:
+		return "contacted"
+	}
+	return "CallSemantics(" + strconv.Itoa(int(s)) + ")"
+}
+
+// toggle returns the other call semantics
+func (s CallSemantics) toggle() CallSemantics {
+	if s == Contacted {
+		return Called
+	}
+	return Contacted
+}
+
+// SemanticsOf returns the call semantics of the call graph of c, i.e.
+// Contacted if c implements
+//
+//	Semantics() CallSemantics
+//
+// returning Contacted, Called otherwise
+func SemanticsOf(c Ciid) CallSemantics {
+	if s, ok := c.(interface{ Semantics() CallSemantics }); ok {
+		return s.Semantics()
+	}
+	return Called
+}
+
+// ownSemantics returns true if call, called by a Ciid with the semantics s,
+// is marked with its own semantics. Calls without calls inherit s, their
+// semantics do not matter.
+func ownSemantics(s CallSemantics, call Ciid) bool {
+	return len(call.Ciids()) > 0 && SemanticsOf(call) != s
+}
+
+// Canonical returns a copy of the call graph of c with the call semantics s.
+// For Called the calls are kept as they are, including their semantics. For
+// Contacted calls of the same service, i.e. with equal Sn, Vn and Va, are
+// merged into one and sorted by Sn, Vn and Va on every level. A merged
+// service keeps the epoch of its first call recorded by confirmation, and
+// calls every service contacted by any of its calls.
+func Canonical(c Ciid, s CallSemantics) *StdCiid {
+	var n *StdCiid
+	if s == Contacted {
+		n = contacted(c)
+	} else {
+		n = called(c)
+	}
+	n.semantics = s
+	return n
+}
+
+func copyCiid(c Ciid) *StdCiid {
+	m := c.Miid()
+	return &StdCiid{
+		miid:      &StdMiid{sn: m.Sn(), vn: m.Vn(), va: m.Va(), t: m.T()},
+		expected:  IsExpected(c),
+		semantics: SemanticsOf(c),
+	}
+}
+
+func called(c Ciid) *StdCiid {
+	n := copyCiid(c)
+	for _, call := range c.Ciids() {
+		n.ciids = append(n.ciids, called(call))
+	}
+	return n
+}
+
+func contacted(c Ciid) *StdCiid {
+	n := copyCiid(c)
+	n.semantics = Contacted
+	merged := map[[3]string]*StdCiid{}
+	var keys [][3]string
+	for _, call := range c.Ciids() {
+		m := call.Miid()
+		key := [3]string{m.Sn(), m.Vn(), m.Va()}
+		s, ok := merged[key]
+		if !ok {
+			s = copyCiid(call)
+			merged[key] = s
+			keys = append(keys, key)
+		} else if s.expected && !IsExpected(call) {
+			s.miid, s.expected = copyCiid(call).miid, false
+		}
+		s.ciids = append(s.ciids, call.Ciids()...)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+	for _, key := range keys {
+		n.ciids = append(n.ciids, contacted(merged[key]))
+	}
+	return n
+}
@@ -0,0 +1,181 @@
+package instanceid
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		s    CallSemantics
+		want string
+	}{
+		{
+			"called keeps order and repeated calls",
+			"gw/1%1s(db/1%2s+mon/1%3s+db/1%4s)",
+			Called,
+			"gw/1%1s(db/1%2s+mon/1%3s+db/1%4s)",
+		},
+		{
+			"contacted merges and sorts",
+			"gw/1%1s(mon/1%3s+db/1%2s+db/1%4s)",
+			Contacted,
+			"+gw/1%1s(db/1%2s+mon/1%3s)",
+		},
+		{
+			"contacted distinguishes versions and Va",
+			"gw/1%1s(db/2%2s+db/1/b%3s+db/1/a%4s+db/1%5s)",
+			Contacted,
+			"+gw/1%1s(db/1%5s+db/1/a%4s+db/1/b%3s+db/2%2s)",
+		},
+		{
+			"contacted merges calls of merged services",
+			"gw/1%1s(db/1%2s(storage/1%3s+cache/1%4s)+db/1%5s(storage/1%6s+index/1%7s))",
+			Contacted,
+			"+gw/1%1s(db/1%2s(cache/1%4s+index/1%7s+storage/1%3s))",
+		},
+		{
+			"called from contacted",
+			"+gw/1%1s(db/1%2s+mon/1%3s)",
+			Called,
+			"gw/1%1s(db/1%2s+mon/1%3s)",
+		},
+		{
+			"contacted twice",
+			"+gw/1%1s(db/1%2s+mon/1%3s)",
+			Contacted,
+			"+gw/1%1s(db/1%2s+mon/1%3s)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewStdCiid(tt.id)
+			got := Canonical(c, tt.s)
+			if got.String() != tt.want {
+				t.Errorf("Canonical() = %v, want %v", got, tt.want)
+			}
+			if SemanticsOf(got) != tt.s {
+				t.Errorf("SemanticsOf() = %v, want %v", SemanticsOf(got), tt.s)
+			}
+			if c.String() != tt.id {
+				t.Errorf("Canonical() modified its argument to %v", c)
+			}
+		})
+	}
+}
+
+func TestParseCiid_contacted(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    CallSemantics
+		wantErr bool
+	}{
+		{"gw/1%1s(db/1%2s)", Called, false},
+		{"+gw/1%1s(db/1%2s)", Contacted, false},
+		{"+", Contacted, true},
+		{"++gw/1%1s", Called, true},
+		{"gw/1%1s(+db/1%2s(st/1%3s))", Called, false},
+		{"+gw/1%1s(+db/1%2s(st/1%3s)+mon/1%4s)", Contacted, false},
+		{"gw/1%1s(+)", Called, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			c, err := ParseCiid(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCiid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := SemanticsOf(c); got != tt.want {
+				t.Errorf("SemanticsOf() = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr && c.String() != tt.id {
+				t.Errorf("String() = %v, want %v", c, tt.id)
+			}
+		})
+	}
+}
+
+func TestContacted_nested(t *testing.T) {
+	// a recorded call graph keeps its semantics if it differs
+	c := NewStdCiid("gw/1%1s")
+	c.SetCiids(Stack{NewStdCiid("+db/1%2s(storage/1%3s)"), NewStdCiid("+mon/1%4s")})
+	if got, want := c.String(), "gw/1%1s(+db/1%2s(storage/1%3s)+mon/1%4s)"; got != want {
+		t.Errorf("String() = %v, want %v", got, want)
+	}
+	if got, want := Freeze(NewStdCiid("+db/1%2s")).String(), "+db/1%2s"; got != want {
+		t.Errorf("Freeze() = %v, want %v", got, want)
+	}
+}
+
+func TestContacted_nestedRoundTrip(t *testing.T) {
+	tests := []struct {
+		id   string
+		want []CallSemantics
+	}{
+		{"gw/1%1s(db/1%2s(st/1%3s))", []CallSemantics{Called, Called, Called}},
+		{"gw/1%1s(+db/1%2s(st/1%3s))", []CallSemantics{Called, Contacted, Contacted}},
+		{"+gw/1%1s(db/1%2s(st/1%3s))", []CallSemantics{Contacted, Contacted, Contacted}},
+		{"+gw/1%1s(+db/1%2s(st/1%3s))", []CallSemantics{Contacted, Called, Called}},
+		{"gw/1%1s(+db/1%2s(+st/1%3s(x/1%4s)))", []CallSemantics{Called, Contacted, Called, Called}},
+		{"gw/1%1s(a/1%1s++?db/x%2s(st/1%3s))", []CallSemantics{Called, Called, Contacted, Contacted}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			c, err := ParseCiid(tt.id)
+			if err != nil {
+				t.Fatalf("ParseCiid() error = %v", err)
+			}
+			if got := c.String(); got != tt.id {
+				t.Errorf("String() = %v, want %v", got, tt.id)
+			}
+			var got []CallSemantics
+			Walk(c, func(_ []Ciid, node Ciid) error {
+				got = append(got, SemanticsOf(node))
+				return nil
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SemanticsOf() = %v, want %v", got, tt.want)
+			}
+
+			js, _ := json.Marshal(c)
+			var back StdCiid
+			if err := json.Unmarshal(js, &back); err != nil || back.String() != tt.id {
+				t.Errorf("json.Unmarshal(%s) = %v, %v, want %v", js, back, err, tt.id)
+			}
+			if got := Canonical(c, Called).String(); SemanticsOf(c) == Called && got != tt.id {
+				t.Errorf("Canonical() = %v, want %v", got, tt.id)
+			}
+		})
+	}
+}
+
+func TestContacted_json(t *testing.T) {
+	c := NewStdCiid("+gw/1%1s(db/1%2s)")
+	js, _ := json.Marshal(c)
+	if got, want := string(js), `{"sn":"gw","vn":"1","t":1,"semantics":"contacted","calls":[{"sn":"db","vn":"1","t":2}]}`; got != want {
+		t.Errorf("json.Marshal() = %v, want %v", got, want)
+	}
+	var back StdCiid
+	if err := json.Unmarshal(js, &back); err != nil || back.String() != c.String() {
+		t.Errorf("json.Unmarshal() = %v, %v, want %v", back, err, c)
+	}
+}
+
+func TestRecorder_contacted(t *testing.T) {
+	r := NewRecorder(NewStdMiid("gw/1%-1s"), time.Now()).SetMode(ByExpectation).SetSemantics(Contacted)
+	r.Record(NewStdCiid("mon/1%3s"))
+	r.Expect(NewExternalMiid("db", ""))
+	i, _ := r.Expect(NewExternalMiid("db", ""))
+	r.Confirm(i, NewStdCiid("db/x%7s"))
+
+	c := r.Ciid()
+	if got, want := c.String(), "+gw/1%0s(db/x%7s+mon/1%3s)"; got != want {
+		t.Errorf("Recorder.Ciid() = %v, want %v", got, want)
+	}
+	if IsExpected(c.Ciids()[0]) {
+		t.Errorf("IsExpected() = true for a service confirmed once, want false")
+	}
+}
@@ -0,0 +1,237 @@
+package instanceid
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/theovassiliou/base64url"
+)
+
+// SignatureHeader is the HTTP header transmitting the Signatures of the
+// Ciid in the X-Instance-Id header
+const SignatureHeader = "X-Instance-Id-Signature"
+
+// Signer signs messages with the key of a service
+type Signer interface {
+	Sign(message []byte) []byte
+}
+
+// Verifier verifies the signatures of a Signer
+type Verifier interface {
+	Verify(message, signature []byte) bool
+}
+
+// HMACKey signs and verifies with HMAC-SHA256
+type HMACKey []byte
+
+// Sign implements Signer
+func (k HMACKey) Sign(message []byte) []byte {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// Verify implements Verifier
+func (k HMACKey) Verify(message, signature []byte) bool {
+	return hmac.Equal(k.Sign(message), signature)
+}
+
+// Ed25519Signer signs with an Ed25519 private key
+type Ed25519Signer struct {
+	Key ed25519.PrivateKey
+}
+
+// Sign implements Signer
+func (s Ed25519Signer) Sign(message []byte) []byte {
+	return ed25519.Sign(s.Key, message)
+}
+
+// Ed25519Verifier verifies with an Ed25519 public key
+type Ed25519Verifier struct {
+	Key ed25519.PublicKey
+}
+
+// Verify implements Verifier
+func (v Ed25519Verifier) Verify(message, signature []byte) bool {
+	return len(v.Key) == ed25519.PublicKeySize && ed25519.Verify(v.Key, message, signature)
+}
+
+// ServiceKey is the Verifier of the key of the service named Sn
+type ServiceKey struct {
+	Sn string
+	Verifier
+}
+
+// Keyring holds the keys of the services by key ID, e.g.
+//
+//	Keyring{"gw-2026": {Sn: "gateway", Verifier: HMACKey(secret)}}
+type Keyring map[string]ServiceKey
+
+// Signature is the signature of one Ciid of a call graph by the service it
+// identifies
+type Signature struct {
+	// KeyID identifies the key in the Keyring, empty if unsigned
+	KeyID string
+
+	// Value is the signature
+	Value []byte
+}
+
+// Signatures lists the Signatures of every Ciid of a call graph in
+// pre-order. A service signs its Miid and the SHA-256 digests of the Ciids
+// it has called, so that its Signature covers the complete call graph,
+// while the Signatures of the called services prove which service emitted
+// which part of the call graph.
+type Signatures []Signature
+
+// String returns the textual representation used in SignatureHeader, the
+// signatures as "keyID:base64url(signature)" separated by ',', empty for
+// unsigned Ciids
+func (s Signatures) String() string {
+	entries := make([]string, len(s))
+	for i, sig := range s {
+		if sig.KeyID != "" {
+			entries[i] = sig.KeyID + ":" + base64url.Encode(sig.Value)
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// ParseSignatures parses the textual representation of Signatures
+func ParseSignatures(v string) (Signatures, error) {
+	entries := strings.Split(v, ",")
+	s := make(Signatures, len(entries))
+	for i, e := range entries {
+		if e == "" {
+			continue
+		}
+		colon := strings.LastIndexByte(e, ':')
+		if colon <= 0 {
+			return nil, errors.New("instanceid: signature " + strconv.Itoa(i) + " without key ID")
+		}
+		value, err := base64url.Decode(e[colon+1:])
+		if err != nil || len(value) == 0 {
+			return nil, errors.New("instanceid: signature " + strconv.Itoa(i) + " not base64url encoded")
+		}
+		s[i] = Signature{KeyID: e[:colon], Value: value}
+	}
+	return s, nil
+}
+
+// Sign returns the Signatures of the call graph c, with c signed by key
+// identified by keyID. calls maps the textual representation of a Ciid
+// called by c to its Signatures, as received from the called service.
+// Called Ciids without matching Signatures are unsigned, covered by the
+// signature of c only.
+func Sign(c Ciid, calls map[string]Signatures, keyID string, key Signer) Signatures {
+	sigs := Signatures{{KeyID: keyID, Value: key.Sign(signedMessage(c))}}
+	for _, call := range c.Ciids() {
+		n := Count(call)
+		if s, ok := calls[call.String()]; ok && len(s) == n {
+			sigs = append(sigs, s...)
+		} else {
+			sigs = append(sigs, make(Signatures, n)...)
+		}
+	}
+	return sigs
+}
+
+// signedMessage returns the message signed for c: the Miid and the hex
+// encoded SHA-256 digests of the calls, as they appear in the textual
+// representation of c, in Ciid notation
+func signedMessage(c Ciid) []byte {
+	sB := strings.Builder{}
+	sB.WriteString(c.Miid().String())
+	for i, call := range c.Ciids() {
+		if i == 0 {
+			sB.WriteString("(")
+		} else {
+			sB.WriteString("+")
+		}
+		digest := sha256.Sum256([]byte(callString(SemanticsOf(c), call)))
+		sB.WriteString(hex.EncodeToString(digest[:]))
+		if i == len(c.Ciids())-1 {
+			sB.WriteString(")")
+		}
+	}
+	return []byte(sB.String())
+}
+
+// SignatureError reports the Ciid of a call graph whose signature fails
+type SignatureError struct {
+	// Path lists the service names from the outermost Ciid down to the
+	// failing one
+	Path []string
+
+	// KeyID identifies the key of the failing signature
+	KeyID string
+
+	// Reason describes the failure
+	Reason string
+}
+
+// Error returns the textual representation of the signature error
+func (e *SignatureError) Error() string {
+	s := "instanceid: signature of " + strings.Join(e.Path, "/")
+	if e.KeyID != "" {
+		s += " by key " + e.KeyID
+	}
+	return s + ": " + e.Reason
+}
+
+// Verify verifies the Signatures of the call graph c with the keys of the
+// keyring. Every Ciid must be signed with a key of the service it
+// identifies. The outermost Ciid must be signed, other unsigned Ciids are
+// covered by the signature of their caller. Verify reports the failing
+// signature closest to the leaves as *SignatureError, i.e. the hop where the
+// call graph has been changed.
+func Verify(c Ciid, sigs Signatures, keyring Keyring) error {
+	type hop struct {
+		path []string
+		node Ciid
+	}
+	var hops []hop
+	Walk(c, func(path []Ciid, node Ciid) error {
+		names := make([]string, 0, len(path)+1)
+		for _, p := range path {
+			names = append(names, p.Miid().Sn())
+		}
+		hops = append(hops, hop{append(names, node.Miid().Sn()), node})
+		return nil
+	})
+	if len(sigs) != len(hops) {
+		return &SignatureError{
+			Path:   hops[0].path,
+			Reason: strconv.Itoa(len(sigs)) + " signatures for " + strconv.Itoa(len(hops)) + " Ciids",
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		sig := sigs[i]
+		fail := func(reason string) error {
+			return &SignatureError{Path: hops[i].path, KeyID: sig.KeyID, Reason: reason}
+		}
+		if sig.KeyID == "" {
+			if i == 0 {
+				return fail("unsigned")
+			}
+			continue
+		}
+		k, ok := keyring[sig.KeyID]
+		if !ok || k.Verifier == nil {
+			return fail("unknown key")
+		}
+		if k.Sn != hops[i].node.Miid().Sn() {
+			return fail("key of service " + strconv.Quote(k.Sn))
+		}
+		if !k.Verify(signedMessage(hops[i].node), sig.Value) {
+			return fail("signature mismatch")
+		}
+	}
+	return nil
+}
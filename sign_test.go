@@ -0,0 +1,149 @@
+package instanceid
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// signedGraph returns gw calling db calling storage, each signed by its own
+// key, plus mon, unsigned
+func signedGraph(t *testing.T) (Ciid, Signatures, Keyring) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := Keyring{
+		"gw":      {"gw", HMACKey("gw-secret")},
+		"db":      {"db", Ed25519Verifier{pub}},
+		"storage": {"storage", HMACKey("storage-secret")},
+	}
+
+	storage := NewStdCiid("storage/0.2%3s")
+	storageSigs := Sign(storage, nil, "storage", HMACKey("storage-secret"))
+
+	db := NewStdCiid("db/1.2%2s")
+	db.SetCiids(Stack{storage})
+	dbSigs := Sign(db, map[string]Signatures{storage.String(): storageSigs}, "db", Ed25519Signer{priv})
+
+	gw := NewStdCiid("gw/1.1%1s")
+	gw.SetCiids(Stack{db, NewStdCiid("mon/1.1%4s")})
+	gwSigs := Sign(gw, map[string]Signatures{db.String(): dbSigs}, "gw", HMACKey("gw-secret"))
+	return gw, gwSigs, keyring
+}
+
+func TestVerify(t *testing.T) {
+	c, sigs, keyring := signedGraph(t)
+	if got := []string{sigs[0].KeyID, sigs[1].KeyID, sigs[2].KeyID, sigs[3].KeyID}; !reflect.DeepEqual(got, []string{"gw", "db", "storage", ""}) {
+		t.Fatalf("Sign() key IDs = %v", got)
+	}
+	if err := Verify(c, sigs, keyring); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	parsed, err := ParseSignatures(sigs.String())
+	if err != nil || !reflect.DeepEqual(parsed, sigs) {
+		t.Errorf("ParseSignatures() = %v, %v, want %v", parsed, err, sigs)
+	}
+}
+
+func TestVerify_tampered(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(c Ciid, sigs Signatures, keyring Keyring) (Ciid, Signatures, Keyring)
+		want    []string
+		wantKey string
+	}{
+		{
+			"storage changed",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				return NewStdCiid(strings.Replace(c.String(), "storage/0.2", "storage/0.3", 1)), sigs, k
+			},
+			[]string{"gw", "db", "storage"}, "storage",
+		},
+		{
+			"unsigned mon changed",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				return NewStdCiid(strings.Replace(c.String(), "mon/1.1", "mon/6.6", 1)), sigs, k
+			},
+			[]string{"gw"}, "gw",
+		},
+		{
+			"db changed",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				return NewStdCiid(strings.Replace(c.String(), "db/1.2%2s", "db/1.2%9s", 1)), sigs, k
+			},
+			[]string{"gw", "db"}, "db",
+		},
+		{
+			"db semantics changed",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				return NewStdCiid(strings.Replace(c.String(), "(db/", "(+db/", 1)), sigs, k
+			},
+			[]string{"gw"}, "gw",
+		},
+		{
+			"unknown key",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				delete(k, "db")
+				return c, sigs, k
+			},
+			[]string{"gw", "db"}, "db",
+		},
+		{
+			"storage signed by gw",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				storage := NewStdCiid("storage/0.2%3s")
+				sigs[2] = Sign(storage, nil, "gw", HMACKey("gw-secret"))[0]
+				return c, sigs, k
+			},
+			[]string{"gw", "db", "storage"}, "gw",
+		},
+		{
+			"key of another service",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				k["storage"] = ServiceKey{"db", k["storage"].Verifier}
+				return c, sigs, k
+			},
+			[]string{"gw", "db", "storage"}, "storage",
+		},
+		{
+			"signature stripped",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				sigs[0] = Signature{}
+				return c, sigs, k
+			},
+			[]string{"gw"}, "",
+		},
+		{
+			"signatures missing",
+			func(c Ciid, sigs Signatures, k Keyring) (Ciid, Signatures, Keyring) {
+				return c, sigs[:2], k
+			},
+			[]string{"gw"}, "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, sigs, keyring := tt.tamper(signedGraph(t))
+			err := Verify(c, sigs, keyring)
+			var sErr *SignatureError
+			if !errors.As(err, &sErr) {
+				t.Fatalf("Verify() error = %v, want *SignatureError", err)
+			}
+			if !reflect.DeepEqual(sErr.Path, tt.want) || sErr.KeyID != tt.wantKey {
+				t.Errorf("Verify() error = %v, want failure of %v by key %q", err, tt.want, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestParseSignatures_errors(t *testing.T) {
+	for _, v := range []string{"abc", ":abc", "k:", "k:!!"} {
+		if _, err := ParseSignatures(v); err == nil {
+			t.Errorf("ParseSignatures(%q) error = nil, want error", v)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Package sql records the databases a request touches. Driver wraps a
+// database/sql driver and records every distinct database used with a
+// context carrying a Recorder, see iid.RecorderFrom, as an external service.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	iid "github.com/theovassiliou/instanceidentification"
+)
+
+// Driver wraps a driver.Driver, e.g.
+//
+//	sql.Register("iid-postgres", &iidsql.Driver{Driver: &pq.Driver{}, Name: "postgres", VersionQuery: "SHOW server_version"})
+//
+// A database is recorded once per request with the Miid returned by Miid.
+// Only the context-aware methods of database/sql, e.g. QueryContext, record.
+type Driver struct {
+	// Driver is the wrapped driver
+	Driver driver.Driver
+
+	// Name is the service name of the databases, e.g. the driver name
+	Name string
+
+	// VersionQuery returns the server version in the first column of its
+	// first row, e.g. "SELECT version()". It is queried once per connection
+	// when the connection is opened, and again before the connection is
+	// used if the context of the query has been done. It is never queried
+	// within a transaction. If empty, or if the query fails, the version
+	// number is iid.ExternalVn.
+	VersionQuery string
+
+	// Target returns the database of a data source name. If nil
+	// DefaultTarget is used.
+	Target func(dsn string) string
+}
+
+// DefaultTarget returns the host and database of dsn without credentials or
+// parameters, for URLs, e.g. postgres://user:pw@db:5432/app?sslmode=disable,
+// key/value strings, e.g. host=db port=5432 dbname=app password=pw, and
+// MySQL-style names, e.g. user:pw@tcp(db:3306)/app?parseTime=true.
+func DefaultTarget(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host + u.Path
+	}
+	if i := strings.IndexAny(dsn, "=?@/:"); i > 0 && dsn[i] == '=' {
+		var host, port, db string
+		for _, f := range strings.Fields(dsn) {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch v := strings.Trim(kv[1], "'"); kv[0] {
+			case "host":
+				host = v
+			case "port":
+				port = ":" + v
+			case "dbname":
+				db = "/" + v
+			}
+		}
+		return host + port + db
+	}
+	if i := strings.LastIndex(dsn, "@"); i >= 0 {
+		dsn = dsn[i+1:]
+	}
+	if i := strings.Index(dsn, "?"); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return dsn
+}
+
+// Miid returns the Miid recorded for the database of dsn, an external service
+// named Name with the server version as version number, see
+// iid.NewExternalMiid
+func (d *Driver) Miid(dsn, version string) iid.Miid {
+	target := d.Target
+	if target == nil {
+		target = DefaultTarget
+	}
+	m := iid.FreezeMiid(iid.NewExternalMiid(d.Name, target(dsn)))
+	if version != "" {
+		m = m.WithVn(version)
+	}
+	return m
+}
+
+// Open implements driver.Driver
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return d.conn(context.Background(), c, dsn), nil
+}
+
+// OpenConnector implements driver.DriverContext
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	c := &connector{driver: d, dsn: dsn}
+	if dc, ok := d.Driver.(driver.DriverContext); ok {
+		base, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		c.base = base
+	}
+	return c, nil
+}
+
+// conn wraps the connection c to the database of dsn opened with ctx
+func (d *Driver) conn(ctx context.Context, c driver.Conn, dsn string) *conn {
+	cn := &conn{Conn: c, driver: d, dsn: dsn}
+	cn.resolve(ctx)
+	return cn
+}
+
+// connector opens connections with the connector of the wrapped driver, or
+// its Open if it has none
+type connector struct {
+	driver *Driver
+	dsn    string
+	base   driver.Connector
+}
+
+// Connect implements driver.Connector
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var cn driver.Conn
+	var err error
+	if c.base != nil {
+		cn, err = c.base.Connect(ctx)
+	} else {
+		cn, err = c.driver.Driver.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.driver.conn(ctx, cn, c.dsn), nil
+}
+
+// Driver implements driver.Connector
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// conn records its database with the calls made with a Recorder. Like any
+// driver.Conn it is not used concurrently.
+type conn struct {
+	driver.Conn
+	driver *Driver
+	dsn    string
+
+	// miid is nil until the version is known
+	miid iid.Miid
+	tx   bool
+}
+
+// resolve sets the Miid of the database unless known. If the version query
+// fails because ctx is done the Miid is left unknown, so that it is resolved
+// with the next context.
+func (c *conn) resolve(ctx context.Context) {
+	if c.miid != nil || c.tx {
+		return
+	}
+	v, err := c.version(ctx)
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	c.miid = c.driver.Miid(c.dsn, v)
+}
+
+// record records the database into the Recorder carried by ctx. Within a
+// transaction the version number of a database with unknown Miid is
+// iid.ExternalVn.
+func (c *conn) record(ctx context.Context) {
+	rec := iid.RecorderFrom(ctx)
+	if rec == nil {
+		return
+	}
+	c.resolve(ctx)
+	m := c.miid
+	if m == nil {
+		m = c.driver.Miid(c.dsn, "")
+	}
+	rec.RecordOnce(iid.NewCiidBuilder(m).Build())
+}
+
+// version returns the server version returned by the VersionQuery, or "" if
+// there is none
+func (c *conn) version(ctx context.Context) (string, error) {
+	if c.driver.VersionQuery == "" {
+		return "", nil
+	}
+	var rows driver.Rows
+	var err error
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		rows, err = q.QueryContext(ctx, c.driver.VersionQuery, nil)
+	} else {
+		var stmt driver.Stmt
+		if stmt, err = c.Conn.Prepare(c.driver.VersionQuery); err == nil {
+			defer stmt.Close()
+			rows, err = stmt.Query(nil)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	if len(dest) == 0 {
+		return "", nil
+	}
+	if err := rows.Next(dest); err != nil {
+		if err == io.EOF {
+			return "", nil
+		}
+		return "", err
+	}
+	switch v := dest[0].(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", nil
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		// database/sql falls back to PrepareContext
+		return nil, driver.ErrSkip
+	}
+	c.record(ctx)
+	return q.QueryContext(ctx, query, args)
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql falls back to PrepareContext
+		return nil, driver.ErrSkip
+	}
+	c.record(ctx)
+	return e.ExecContext(ctx, query, args)
+}
+
+// PrepareContext implements driver.ConnPrepareContext
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	c.record(ctx)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx implements driver.ConnBeginTx
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	b, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		// like database/sql for drivers without ConnBeginTx
+		if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+			return nil, errors.New("sql: driver does not support non-default isolation level")
+		}
+		if opts.ReadOnly {
+			return nil, errors.New("sql: driver does not support read-only transactions")
+		}
+	}
+	// the version is not queried within the transaction
+	c.resolve(ctx)
+	c.record(ctx)
+	var t driver.Tx
+	var err error
+	if ok {
+		t, err = b.BeginTx(ctx, opts)
+	} else {
+		t, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.tx = true
+	return &tx{Tx: t, conn: c}, nil
+}
+
+// tx marks the end of the transaction of conn
+type tx struct {
+	driver.Tx
+	conn *conn
+}
+
+// Commit implements driver.Tx
+func (t *tx) Commit() error {
+	t.conn.tx = false
+	return t.Tx.Commit()
+}
+
+// Rollback implements driver.Tx
+func (t *tx) Rollback() error {
+	t.conn.tx = false
+	return t.Tx.Rollback()
+}
+
+// Ping implements driver.Pinger
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// ResetSession implements driver.SessionResetter
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
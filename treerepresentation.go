@@ -7,24 +7,22 @@ import (
 )
 
 // TreePrint prints a tree representation of the complete call-graph of a
-// Ciid
+// Ciid. Ciids recorded by expectation are marked as expected.
 func (c StdCiid) TreePrint() string {
 	tree := treeprint.New()
-	tree = c.visitCiid(tree)
+	branches := []treeprint.Tree{tree}
+	Walk(&c, func(path []Ciid, node Ciid) error {
+		m := node.Miid()
+		x := branches[len(path)].AddBranch(m.Sn() + "/" + m.Vn())
+		if m.String() != "" {
+			meta := strconv.Itoa(m.T()) + "s"
+			if IsExpected(node) {
+				meta += ", expected"
+			}
+			x.SetMetaValue(meta)
+		}
+		branches = append(branches[:len(path)+1], x)
+		return nil
+	})
 	return tree.String()
 }
-
-func (c StdCiid) visitCiid(t treeprint.Tree) treeprint.Tree {
-	x := t.AddBranch(c.miid.Sn() + "/" + c.miid.Vn())
-	if c.Miid().(*StdMiid).metadata() != "" {
-		x.SetMetaValue(strconv.Itoa(c.Miid().T()) + "s")
-	}
-	for _, s := range c.Ciids() {
-		s.(*StdCiid).visitCiid(x)
-	}
-	return t
-}
-
-func (m StdMiid) metadata() string {
-	return m.String()
-}
@@ -0,0 +1,124 @@
+package instanceid
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validate checks ciid against the Ciid grammar
+//
+//	CIID := ["+"] ["?"] MIID [ "(" UIDs ")" ]
+//	UIDs := CIID [ "+" CIID ]*
+//	MIID := <sN> "/" <vN> ["/" <vA>] "%" <t> "s"
+//
+// where <sN> and <vN> are non-empty sequences of printable, non-space
+// characters other than '/', '%', '+', '(', ')' and '?', <vA> additionally
+// allows '/' and '?', and <t> is a signed decimal integer. Other characters
+// have to be escaped, see EscapeName. A leading ContactedMarker marks the
+// semantics of a Ciid, a leading ExpectedMarker a Ciid recorded by
+// expectation. It returns every violation found, or nil if ciid is valid.
+func Validate(ciid string) []Violation {
+	p := ciidParser{in: ciid, opts: ParserOptions{Strict: true}, all: true}
+	p.parse()
+	return p.violations
+}
+
+// validateMiid returns all violations of the MIID grammar in miid, offsets
+// relative to miid
+func validateMiid(miid string) (vs []Violation) {
+	fail := func(kind ErrorKind, pos int, token string) {
+		vs = append(vs, Violation{Offset: pos, Token: token, Kind: kind})
+	}
+
+	if miid == "" {
+		fail(KindEmpty, 0, "")
+		return vs
+	}
+
+	body, epoch := miid, ""
+	pct := strings.LastIndexByte(miid, '%')
+	if pct >= 0 {
+		body, epoch = miid[:pct], miid[pct+1:]
+	}
+
+	// <sN> "/" <vN> ["/" <vA>]
+	slash := strings.IndexByte(body, '/')
+	if slash < 0 {
+		slash = len(body)
+	}
+	if slash == 0 {
+		fail(KindMissingName, 0, miid)
+	} else if i := invalidRune(body[:slash], false); i >= 0 {
+		fail(KindInvalidName, i, body[:slash])
+	}
+	if slash == len(body) {
+		fail(KindMissingVersion, slash, miid)
+	} else {
+		vn := body[slash+1:]
+		va := ""
+		hasVa := false
+		if i := strings.IndexByte(vn, '/'); i >= 0 {
+			vn, va, hasVa = vn[:i], vn[i+1:], true
+		}
+		if vn == "" {
+			fail(KindMissingVersion, slash+1, miid)
+		} else if i := invalidRune(vn, false); i >= 0 {
+			fail(KindInvalidVersion, slash+1+i, vn)
+		}
+		if hasVa {
+			vaStart := slash + len(vn) + 2
+			if va == "" {
+				fail(KindInvalidVa, vaStart, "")
+			} else if i := invalidRune(va, true); i >= 0 {
+				fail(KindInvalidVa, vaStart+i, va)
+			}
+		}
+	}
+
+	// "%" <t> "s"
+	switch {
+	case pct < 0:
+		fail(KindMissingPercent, len(miid), miid)
+	case !strings.HasSuffix(epoch, "s"):
+		fail(KindMissingSuffix, len(miid), miid[pct:])
+	case !isEpoch(strings.TrimSuffix(epoch, "s")):
+		fail(KindInvalidEpoch, pct+1, strings.TrimSuffix(epoch, "s"))
+	}
+	return vs
+}
+
+// invalidRune returns the offset of the first rune in s outside of the
+// <sN>/<vN> character class, or the <vA> class if slash is set. A '%' is
+// only valid as part of an escape sequence. It returns -1 if all runes are
+// valid.
+func invalidRune(s string, slash bool) int {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1, !unicode.IsGraphic(r), unicode.IsSpace(r):
+			return i
+		case r == '%' && isEscape(s[i:]):
+			size = 3
+		case (r == '/' || r == '?') && slash:
+		case strings.ContainsRune("/%+()?", r):
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// isEpoch returns true if s is a signed decimal integer
+func isEpoch(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
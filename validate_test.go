@@ -0,0 +1,150 @@
+package instanceid
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixtures returns the non-comment lines of the given test set
+func fixtures(t *testing.T, fileName string) (lines []string) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("failed to open: %v", fileName)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if l := scanner.Text(); l != "" && !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+func kinds(vs []Violation) (ks []ErrorKind) {
+	for _, v := range vs {
+		ks = append(ks, v.Kind)
+	}
+	return ks
+}
+
+func TestValidate_validFixtures(t *testing.T) {
+	for i, id := range fixtures(t, "test/iidtestsetValid.txt") {
+		t.Run(fmt.Sprintf("%v:%v", i, id), func(t *testing.T) {
+			if got := Validate(id); got != nil {
+				t.Errorf("Validate() = %v, want none", got)
+			}
+			got, err := ParseCiidWithOptions(id, ParserOptions{Strict: true})
+			if err != nil || got.String() != id {
+				t.Errorf("ParseCiidWithOptions() = %v, %v, want %v", got, err, id)
+			}
+		})
+	}
+}
+
+func TestValidate_invalidFixtures(t *testing.T) {
+	want := map[string][]ErrorKind{
+		"MsA/1.1/xxx%22s+msB/2.0.1/yyyy%444s+(msC/1.4%5555s+msD/2.2%23234s)": {KindUnexpectedPlus, KindUnexpectedPlus, KindEmpty},
+		"MsA/1.1/xxx%22s+msB/2.0.1/yyyy%444s":                                {KindUnexpectedPlus},
+		"HelloWorld":                                                         {KindMissingVersion, KindMissingPercent},
+		"This is a test":                                                     {KindInvalidName, KindMissingVersion, KindMissingPercent},
+		"msa/1.1/additionalinformation/2s":                                   {KindMissingPercent},
+		"msa/1.1/additionalinformation/1":                                    {KindMissingPercent},
+		"msa/1.1/additionalinformation/xs":                                   {KindMissingPercent},
+		"msa/1.1/additionalinformation":                                      {KindMissingPercent},
+		"msa/1.1/additionalinformation%1":                                    {KindMissingSuffix},
+		"msa/1.1/additionalinformation%xs":                                   {KindInvalidEpoch},
+		"DE.TU-BERLIN.ECHO//main-352e3bf/397s":                               {KindMissingVersion, KindMissingPercent},
+	}
+	for i, id := range fixtures(t, "test/iidtestsetInvalid.txt") {
+		t.Run(fmt.Sprintf("%v:%v", i, id), func(t *testing.T) {
+			wantKinds, ok := want[id]
+			if !ok {
+				t.Fatalf("no expectation for %v", id)
+			}
+			if got := kinds(Validate(id)); !reflect.DeepEqual(got, wantKinds) {
+				t.Errorf("Validate() = %v, want %v", got, wantKinds)
+			}
+			_, err := ParseCiidWithOptions(id, ParserOptions{Strict: true})
+			if pErr, ok := err.(*ParseError); !ok || pErr.Kind != wantKinds[0] {
+				t.Errorf("ParseCiidWithOptions() error = %v, want %v", err, wantKinds[0])
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want []Violation
+	}{
+		{
+			"va with slashes",
+			"msa/1.1/feature/branch/2345abcd%22s",
+			nil,
+		},
+		{
+			"nested va with slashes",
+			"msa/1.1%22s(msb/2/a/b/c/d%1s)",
+			nil,
+		},
+		{
+			"expected",
+			"?msa/1.1%22s(?msb/2%1s)",
+			nil,
+		},
+		{
+			"question mark in name",
+			"msa/1.1%22s(m?sb/2%1s)",
+			[]Violation{{Offset: 13, Token: "m?sb", Kind: KindInvalidName, Path: []string{"msa"}}},
+		},
+		{
+			"fractional epoch",
+			"msa/1.1%1.5s",
+			[]Violation{{Offset: 8, Token: "1.5", Kind: KindInvalidEpoch}},
+		},
+		{
+			"space in version",
+			"msa/1 1%22s",
+			[]Violation{{Offset: 5, Token: "1 1", Kind: KindInvalidVersion}},
+		},
+		{
+			"empty va",
+			"msa/1.1/%22s",
+			[]Violation{{Offset: 8, Token: "", Kind: KindInvalidVa}},
+		},
+		{
+			"control character in va",
+			"msa/1.1/a\tb%22s",
+			[]Violation{{Offset: 9, Token: "a\tb", Kind: KindInvalidVa}},
+		},
+		{
+			"every violation",
+			"ms a/1.1%xs(msb/%1s+)",
+			[]Violation{
+				{Offset: 2, Token: "ms a", Kind: KindInvalidName},
+				{Offset: 9, Token: "x", Kind: KindInvalidEpoch},
+				{Offset: 16, Token: "msb/%1s", Kind: KindMissingVersion, Path: []string{"ms a"}},
+				{Offset: 20, Token: ")", Kind: KindEmptyOperand, Path: []string{"ms a"}},
+			},
+		},
+		{
+			"unbalanced",
+			"msa/1.1%1s(msb/1%1s(msc/1%1s)",
+			[]Violation{{Offset: 10, Token: "(", Kind: KindUnbalancedParenthesis, Path: []string{"msa"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Validate(tt.id); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package instanceid
+
+import "errors"
+
+// WalkFunc is called by Walk for every Ciid of a call graph. path lists the
+// Ciids enclosing node, outermost first, so len(path) is the depth of node
+// with the outermost Ciid at depth 0. path is only valid during the call.
+//
+// If WalkFunc returns SkipCalls, the calls of node are not visited. If it
+// returns StopWalk, Walk stops and returns nil. Any other error stops Walk
+// and is returned by it.
+type WalkFunc func(path []Ciid, node Ciid) error
+
+// SkipCalls is returned by a WalkFunc to skip the calls of the current Ciid.
+// It is ignored in post-order.
+var SkipCalls = errors.New("skip calls")
+
+// StopWalk is returned by a WalkFunc to stop the walk without error
+var StopWalk = errors.New("stop walk")
+
+// Walk visits c and all Ciids called by c in pre-order, i.e. every Ciid
+// before its calls, in the order of the calls.
+func Walk(c Ciid, fn WalkFunc) error {
+	return walk(c, fn, false)
+}
+
+// WalkPostOrder visits c and all Ciids called by c in post-order, i.e.
+// every Ciid after its calls, in the order of the calls.
+func WalkPostOrder(c Ciid, fn WalkFunc) error {
+	return walk(c, fn, true)
+}
+
+func walk(c Ciid, fn WalkFunc, post bool) error {
+	err := visit(nil, c, fn, post)
+	if err == StopWalk {
+		return nil
+	}
+	return err
+}
+
+func visit(path []Ciid, node Ciid, fn WalkFunc, post bool) error {
+	if !post {
+		if err := fn(path, node); err == SkipCalls {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	path = append(path, node)
+	for _, call := range node.Ciids() {
+		if err := visit(path, call, fn, post); err != nil {
+			return err
+		}
+	}
+	path = path[:len(path)-1]
+
+	if post {
+		if err := fn(path, node); err != SkipCalls {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns the first Ciid of the call graph of c in pre-order for which
+// match returns true, or nil if there is none
+func Find(c Ciid, match func(Ciid) bool) (found Ciid) {
+	Walk(c, func(_ []Ciid, node Ciid) error {
+		if match(node) {
+			found = node
+			return StopWalk
+		}
+		return nil
+	})
+	return found
+}
+
+// FindAll returns all Ciids of the call graph of c in pre-order for which
+// match returns true
+func FindAll(c Ciid, match func(Ciid) bool) (found []Ciid) {
+	Walk(c, func(_ []Ciid, node Ciid) error {
+		if match(node) {
+			found = append(found, node)
+		}
+		return nil
+	})
+	return found
+}
+
+// Count returns the number of Ciids in the call graph of c, including c
+func Count(c Ciid) (n int) {
+	Walk(c, func(_ []Ciid, _ Ciid) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// Depth returns the nesting depth of the call graph of c. A Ciid without
+// calls has depth 1.
+func Depth(c Ciid) (depth int) {
+	Walk(c, func(path []Ciid, _ Ciid) error {
+		if len(path)+1 > depth {
+			depth = len(path) + 1
+		}
+		return nil
+	})
+	return depth
+}
+
+// Services returns the distinct services of the call graph of c in
+// pre-order. Services are distinct if they differ in Sn, Vn or Va.
+func Services(c Ciid) (services []Miid) {
+	seen := map[[3]string]bool{}
+	Walk(c, func(_ []Ciid, node Ciid) error {
+		m := node.Miid()
+		key := [3]string{m.Sn(), m.Vn(), m.Va()}
+		if !seen[key] {
+			seen[key] = true
+			services = append(services, m)
+		}
+		return nil
+	})
+	return services
+}
+
+// Leaves returns the Ciids of the call graph of c that do not call any
+// other service, in pre-order
+func Leaves(c Ciid) []Ciid {
+	return FindAll(c, func(node Ciid) bool {
+		return len(node.Ciids()) == 0
+	})
+}
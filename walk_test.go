@@ -0,0 +1,154 @@
+package instanceid
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const walkCiid = "gw/1.1%1s(db/1.2%2s(storage/0.2%3s)+mon/1.1%4s+db/1.2%5s)"
+
+// visited returns "depth:sn" for every visited Ciid
+func visited(c Ciid, walker func(Ciid, WalkFunc) error, skip, stop string) (got []string, err error) {
+	err = walker(c, func(path []Ciid, node Ciid) error {
+		var names []string
+		for _, p := range path {
+			names = append(names, p.Miid().Sn())
+		}
+		got = append(got, strings.Join(append(names, node.Miid().Sn()), "/"))
+		switch node.Miid().Sn() {
+		case skip:
+			return SkipCalls
+		case stop:
+			return StopWalk
+		}
+		return nil
+	})
+	return got, err
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		name   string
+		walker func(Ciid, WalkFunc) error
+		skip   string
+		stop   string
+		want   []string
+	}{
+		{
+			"pre-order",
+			Walk, "", "",
+			[]string{"gw", "gw/db", "gw/db/storage", "gw/mon", "gw/db"},
+		},
+		{
+			"post-order",
+			WalkPostOrder, "", "",
+			[]string{"gw/db/storage", "gw/db", "gw/mon", "gw/db", "gw"},
+		},
+		{
+			"skip calls",
+			Walk, "db", "",
+			[]string{"gw", "gw/db", "gw/mon", "gw/db"},
+		},
+		{
+			"skip calls ignored in post-order",
+			WalkPostOrder, "db", "",
+			[]string{"gw/db/storage", "gw/db", "gw/mon", "gw/db", "gw"},
+		},
+		{
+			"stop",
+			Walk, "", "mon",
+			[]string{"gw", "gw/db", "gw/db/storage", "gw/mon"},
+		},
+		{
+			"stop in post-order",
+			WalkPostOrder, "", "db",
+			[]string{"gw/db/storage", "gw/db"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := visited(NewStdCiid(walkCiid), tt.walker, tt.skip, tt.stop)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Walk() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalk_error(t *testing.T) {
+	errFound := errors.New("found")
+	n := 0
+	err := Walk(NewStdCiid(walkCiid), func(_ []Ciid, node Ciid) error {
+		n++
+		if node.Miid().Sn() == "storage" {
+			return errFound
+		}
+		return nil
+	})
+	if err != errFound || n != 3 {
+		t.Errorf("Walk() = %v after %v Ciids, want %v after 3", err, n, errFound)
+	}
+}
+
+func TestFind(t *testing.T) {
+	c := NewStdCiid(walkCiid)
+	isDB := func(node Ciid) bool { return node.Miid().Sn() == "db" }
+
+	if got := Find(c, isDB); got == nil || got.Miid().T() != 2 {
+		t.Errorf("Find() = %v, want db/1.2%%2s", got)
+	}
+	if got := Find(c, func(Ciid) bool { return false }); got != nil {
+		t.Errorf("Find() = %v, want nil", got)
+	}
+	if got := FindAll(c, isDB); len(got) != 2 || got[0].Miid().T() != 2 || got[1].Miid().T() != 5 {
+		t.Errorf("FindAll() = %v, want both db", got)
+	}
+}
+
+func TestCountDepth(t *testing.T) {
+	tests := []struct {
+		ciid      string
+		wantCount int
+		wantDepth int
+	}{
+		{"a/1%1s", 1, 1},
+		{"a/1%1s(b/1%1s+c/1%1s)", 3, 2},
+		{walkCiid, 5, 3},
+		{deepCiid(10), 10, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ciid, func(t *testing.T) {
+			c := NewStdCiid(tt.ciid)
+			if got := Count(c); got != tt.wantCount {
+				t.Errorf("Count() = %v, want %v", got, tt.wantCount)
+			}
+			if got := Depth(c); got != tt.wantDepth {
+				t.Errorf("Depth() = %v, want %v", got, tt.wantDepth)
+			}
+		})
+	}
+}
+
+func TestServices(t *testing.T) {
+	var got []string
+	for _, m := range Services(NewStdCiid(walkCiid)) {
+		got = append(got, m.String())
+	}
+	want := []string{"gw/1.1%1s", "db/1.2%2s", "storage/0.2%3s", "mon/1.1%4s"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Services() = %v, want %v", got, want)
+	}
+}
+
+func TestLeaves(t *testing.T) {
+	var got []string
+	for _, c := range Leaves(NewStdCiid(walkCiid)) {
+		got = append(got, c.String())
+	}
+	want := []string{"storage/0.2%3s", "mon/1.1%4s", "db/1.2%5s"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Leaves() = %v, want %v", got, want)
+	}
+}